@@ -4,9 +4,12 @@ go 1.25.0
 
 require (
 	github.com/BurntSushi/toml v1.6.0
+	github.com/andybalholm/brotli v1.2.0
 	github.com/google/uuid v1.6.0
 	github.com/jmoiron/sqlx v1.4.0
+	github.com/klauspost/compress v1.18.2
 	github.com/platforma-dev/platforma v0.1.0-alpha.24
+	google.golang.org/protobuf v1.36.10
 	modernc.org/sqlite v1.51.0
 )
 
@@ -12,6 +12,7 @@ import (
 	"github.com/platforma-dev/platforma/log"
 	"github.com/platforma-dev/platforma/scheduler"
 
+	"github.com/mishankov/proxymini/internal/certs"
 	"github.com/mishankov/proxymini/internal/config"
 	"github.com/mishankov/proxymini/internal/db"
 	"github.com/mishankov/proxymini/internal/proxy"
@@ -127,6 +128,10 @@ const loginPageHTML = `<!DOCTYPE html>
 // cleanupSchedule is the frequency at which old logs are checked and deleted.
 const cleanupSchedule = "@every 1h"
 
+// healthCheckSchedule is the frequency at which due upstream health checks are run.
+// The interval of each check is configured per proxy route and shorter ones are raised to it.
+var healthCheckSchedule = "@every " + proxy.HealthCheckTick.String()
+
 func Build(conf *config.Config, rlDB *sqlx.DB) (*application.Application, error) {
 	if conf == nil {
 		return nil, fmt.Errorf("config is required")
@@ -135,9 +140,13 @@ func Build(conf *config.Config, rlDB *sqlx.DB) (*application.Application, error)
 	// Request logs
 	rlSvc := requestlog.NewRequestLogService(rlDB)
 	rlHandler := requestlog.NewRequestLogHandler(rlSvc)
+	frameHandler := requestlog.NewWebSocketFrameHandler(rlSvc)
+	eventHandler := requestlog.NewStreamEventHandler(rlSvc)
+	bodyHandler := requestlog.NewBodyHandler(rlSvc)
 
 	// Proxy
 	proxyHandler := proxy.NewProxyHandler(rlSvc, conf)
+	healthHandler := proxy.NewHealthHandler(proxyHandler)
 
 	// WebUI file server
 	appFileServer := http.FileServer(http.FS(frontend.Assets()))
@@ -212,8 +221,36 @@ func Build(conf *config.Config, rlDB *sqlx.DB) (*application.Application, error)
 	})
 	server.Handle("/app/", authMiddleware(http.StripPrefix("/app", appFileServer)))
 	server.Handle("/api/logs", authMiddleware(rlHandler))
+	server.Handle("/api/logs/{id}/frames", authMiddleware(frameHandler))
+	server.Handle("/api/logs/{id}/events", authMiddleware(eventHandler))
+	server.Handle("/api/logs/{id}/body/{part}", authMiddleware(bodyHandler))
+	server.Handle("/api/upstreams", authMiddleware(healthHandler))
 	server.Handle("/", proxyHandler)
 
+	// Decrypted CONNECT tunnels. The CA certificate is public, so it is served without auth to make installing it easy
+	if conf.ForwardProxy.Enabled && conf.ForwardProxy.MITM {
+		ca, err := certs.LoadOrCreateCA(conf.ForwardProxy.CACert, conf.ForwardProxy.CAKey)
+		if err != nil {
+			return nil, fmt.Errorf("load mitm ca: %w", err)
+		}
+		proxyHandler.EnableMITM(ca)
+		server.Handle("/api/mitm/ca.crt", proxy.NewCAHandler(ca))
+	}
+
+	// Forward proxy requests name their target in the request line, so they are served before routing by path
+	if conf.ForwardProxy.Enabled {
+		server.UseFunc(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if proxy.IsForwardProxyRequest(r) {
+					proxyHandler.ServeForward(w, r)
+					return
+				}
+
+				next.ServeHTTP(w, r)
+			})
+		})
+	}
+
 	// App
 	app := application.New()
 
@@ -240,7 +277,24 @@ func Build(conf *config.Config, rlDB *sqlx.DB) (*application.Application, error)
 		app.RegisterService("logs-retention", retentionScheduler)
 	}
 
-	app.RegisterService("api", server)
+	// Upstream health checks
+	healthCheckRunner := application.RunnerFunc(func(ctx context.Context) error {
+		if err := proxyHandler.CheckHealth(ctx); err != nil {
+			log.Error("failed to check upstream health", "error", err)
+		}
+		return nil
+	})
+	healthCheckScheduler, err := scheduler.New(healthCheckSchedule, healthCheckRunner)
+	if err != nil {
+		return nil, fmt.Errorf("create health check scheduler: %w", err)
+	}
+	app.RegisterService("upstream-health", healthCheckScheduler)
+
+	apiServer, err := newHTTPServer(server, conf, httpShutdownTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("create http server: %w", err)
+	}
+	app.RegisterService("api", apiServer)
 
 	return app, nil
 }
@@ -0,0 +1,161 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/platforma-dev/platforma/log"
+
+	"github.com/mishankov/proxymini/internal/certs"
+	"github.com/mishankov/proxymini/internal/config"
+)
+
+// httpServer serves handler on the port with HTTP/1.1 and h2c, HTTP/2 over cleartext with prior knowledge.
+// It replaces the runner of httpserver.HTTPServer, which only speaks HTTP/1.1, while routes are still registered there.
+// With a certificate configured the port serves HTTPS, and a second port can serve plain HTTP or redirect it to HTTPS.
+type httpServer struct {
+	handler         http.Handler
+	port            string
+	shutdownTimeout time.Duration
+
+	tlsConfig     *tls.Config
+	httpPort      string
+	httpsRedirect bool
+}
+
+func newHTTPServer(handler http.Handler, conf *config.Config, shutdownTimeout time.Duration) (*httpServer, error) {
+	s := &httpServer{handler: handler, port: conf.Port, shutdownTimeout: shutdownTimeout}
+
+	if conf.TLSCertFile == "" && conf.TLSKeyFile == "" {
+		return s, nil
+	}
+	if conf.TLSCertFile == "" || conf.TLSKeyFile == "" {
+		return nil, fmt.Errorf("both PROXYMINI_TLS_CERT and PROXYMINI_TLS_KEY are required for TLS")
+	}
+
+	if conf.TLSSelfSigned {
+		hostname, _ := os.Hostname()
+		generated, err := certs.EnsureSelfSigned(conf.TLSCertFile, conf.TLSKeyFile, hostname)
+		if err != nil {
+			return nil, fmt.Errorf("generate self-signed certificate: %w", err)
+		}
+		if generated {
+			log.Info("generated self-signed certificate", "cert", conf.TLSCertFile, "key", conf.TLSKeyFile)
+		}
+	}
+
+	reloader, err := certs.NewReloader(conf.TLSCertFile, conf.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	s.tlsConfig = &tls.Config{GetCertificate: reloader.GetCertificate}
+	s.httpPort = conf.HTTPPort
+	s.httpsRedirect = conf.HTTPSRedirect
+
+	return s, nil
+}
+
+// Run starts the HTTP servers and shuts them down gracefully when ctx is done.
+func (s *httpServer) Run(ctx context.Context) error {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+
+	newServer := func(port string, handler http.Handler) *http.Server {
+		return &http.Server{
+			Addr:              ":" + port,
+			Handler:           handler,
+			Protocols:         protocols,
+			ReadHeaderTimeout: 1 * time.Second,
+			BaseContext:       func(_ net.Listener) context.Context { return ctx },
+		}
+	}
+
+	server := newServer(s.port, s.handler)
+	server.TLSConfig = s.tlsConfig
+	servers := []*http.Server{server}
+
+	if s.tlsConfig != nil && s.httpPort != "" {
+		handler := s.handler
+		if s.httpsRedirect {
+			handler = httpsRedirect(s.port)
+		}
+		servers = append(servers, newServer(s.httpPort, handler))
+	}
+
+	errc := make(chan error, len(servers))
+	for _, server := range servers {
+		go func() {
+			var err error
+			if server.TLSConfig != nil {
+				log.InfoContext(ctx, "starting https server", "address", server.Addr)
+				err = server.ListenAndServeTLS("", "")
+			} else {
+				log.InfoContext(ctx, "starting http server", "address", server.Addr)
+				err = server.ListenAndServe()
+			}
+
+			if !errors.Is(err, http.ErrServerClosed) {
+				errc <- fmt.Errorf("server on %s: %w", server.Addr, err)
+			}
+			log.InfoContext(ctx, "stopped serving new connections", "address", server.Addr)
+		}()
+	}
+
+	var runErr error
+	select {
+	case runErr = <-errc:
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	for _, server := range servers {
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			return fmt.Errorf("failed to gracefully shutdown HTTP server: %w", err)
+		}
+	}
+	if runErr != nil {
+		return runErr
+	}
+	log.InfoContext(ctx, "graceful shutdown completed")
+
+	return nil
+}
+
+// Healthcheck returns health check information for the HTTP server.
+func (s *httpServer) Healthcheck(_ context.Context) any {
+	res := map[string]any{
+		"port": s.port,
+		"tls":  s.tlsConfig != nil,
+	}
+	if s.httpPort != "" {
+		res["httpPort"] = s.httpPort
+	}
+
+	return res
+}
+
+// httpsRedirect redirects requests to the same URL on the HTTPS port.
+func httpsRedirect(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
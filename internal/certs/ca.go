@@ -0,0 +1,190 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// caValidity is how long a generated CA is valid.
+	caValidity = 10 * 365 * 24 * time.Hour
+	// leafValidity is how long issued host certificates are valid. Leaves are issued on demand, so they can be short-lived.
+	leafValidity = 30 * 24 * time.Hour
+	// maxCachedLeaves is the number of issued certificates kept. The cache starts over when it is full.
+	maxCachedLeaves = 1000
+)
+
+// CA is a local certificate authority that issues certificates for any host on the fly.
+// Clients that trust it accept the issued certificates, which lets ProxyMini decrypt their TLS traffic.
+type CA struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     crypto.Signer
+	// leafKey is shared by all issued certificates, as generating a key per host buys nothing here.
+	leafKey *ecdsa.PrivateKey
+
+	mu     sync.Mutex
+	leaves map[string]*tls.Certificate
+}
+
+// LoadOrCreateCA loads the CA from certFile and keyFile, or generates one and writes it there if certFile doesn't exist.
+func LoadOrCreateCA(certFile, keyFile string) (*CA, error) {
+	if _, err := os.Stat(certFile); errors.Is(err, os.ErrNotExist) {
+		if err := createCA(certFile, keyFile); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("checking CA certificate: %w", err)
+	}
+
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading CA certificate: %w", err)
+	}
+	if pair.Leaf == nil || !pair.Leaf.IsCA {
+		return nil, fmt.Errorf("%s is not a CA certificate", certFile)
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported CA key type %T", pair.PrivateKey)
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generating key: %w", err)
+	}
+
+	return &CA{
+		cert:    pair.Leaf,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pair.Leaf.Raw}),
+		key:     key,
+		leafKey: leafKey,
+		leaves:  map[string]*tls.Certificate{},
+	}, nil
+}
+
+func createCA(certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("generating key: %w", err)
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"ProxyMini"}, CommonName: "ProxyMini CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("creating CA certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("encoding key: %w", err)
+	}
+
+	if err := writePEM(keyFile, "PRIVATE KEY", keyDER, 0o600); err != nil {
+		return err
+	}
+
+	return writePEM(certFile, "CERTIFICATE", der, 0o644)
+}
+
+// CertPEM returns the CA certificate in PEM format, for installing it in trust stores.
+func (ca *CA) CertPEM() []byte {
+	return ca.certPEM
+}
+
+// Certificate returns a certificate for the host issued by the CA. Certificates are cached until they are about to expire.
+func (ca *CA) Certificate(host string) (*tls.Certificate, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if leaf, ok := ca.leaves[host]; ok && time.Until(leaf.Leaf.NotAfter) > time.Hour {
+		return leaf, nil
+	}
+
+	leaf, err := ca.issue(host)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ca.leaves) >= maxCachedLeaves {
+		clear(ca.leaves)
+	}
+	ca.leaves[host] = leaf
+
+	return leaf, nil
+}
+
+func (ca *CA) issue(host string) (*tls.Certificate, error) {
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	notAfter := time.Now().Add(leafValidity)
+	if notAfter.After(ca.cert.NotAfter) {
+		notAfter = ca.cert.NotAfter
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"ProxyMini"}, CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &ca.leafKey.PublicKey, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("issuing certificate for %s: %w", host, err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("issuing certificate for %s: %w", host, err)
+	}
+
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: ca.leafKey, Leaf: leaf}, nil
+}
+
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generating serial number: %w", err)
+	}
+
+	return serial, nil
+}
@@ -0,0 +1,155 @@
+// Package certs loads and generates the TLS certificates ProxyMini serves.
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// selfSignedValidity is how long generated development certificates are valid.
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// Reloader serves a certificate from a cert and key file and loads them again when either file changes,
+// so renewed certificates are picked up without a restart.
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	certTime time.Time
+	keyTime  time.Time
+}
+
+// NewReloader loads the certificate, so a missing or invalid one is reported on startup.
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetCertificate can be used as tls.Config.GetCertificate. If the changed files can't be loaded,
+// for example while only one of them was replaced, the previous certificate is served.
+func (r *Reloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.load()
+}
+
+func (r *Reloader) load() (*tls.Certificate, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return r.current(fmt.Errorf("reading certificate: %w", err))
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return r.current(fmt.Errorf("reading key: %w", err))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cert != nil && certInfo.ModTime().Equal(r.certTime) && keyInfo.ModTime().Equal(r.keyTime) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("loading certificate: %w", err)
+	}
+
+	r.cert, r.certTime, r.keyTime = &cert, certInfo.ModTime(), keyInfo.ModTime()
+
+	return r.cert, nil
+}
+
+func (r *Reloader) current(err error) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cert != nil {
+		return r.cert, nil
+	}
+
+	return nil, err
+}
+
+// EnsureSelfSigned writes a self-signed certificate for localhost and the given hosts to certFile and keyFile,
+// unless certFile already exists. It reports whether a certificate was generated.
+func EnsureSelfSigned(certFile, keyFile string, hosts ...string) (bool, error) {
+	if _, err := os.Stat(certFile); err == nil {
+		return false, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf("checking certificate: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return false, fmt.Errorf("generating key: %w", err)
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return false, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"ProxyMini"}, CommonName: "ProxyMini development certificate"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range append([]string{"localhost", "127.0.0.1", "::1"}, hosts...) {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return false, fmt.Errorf("creating certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return false, fmt.Errorf("encoding key: %w", err)
+	}
+
+	if err := writePEM(keyFile, "PRIVATE KEY", keyDER, 0o600); err != nil {
+		return false, err
+	}
+	if err := writePEM(certFile, "CERTIFICATE", der, 0o644); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, perm); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+
+	return nil
+}
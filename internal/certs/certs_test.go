@@ -0,0 +1,132 @@
+package certs_test
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mishankov/proxymini/internal/certs"
+)
+
+func TestEnsureSelfSigned_GeneratesOnce(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "dev.crt"), filepath.Join(dir, "dev.key")
+
+	generated, err := certs.EnsureSelfSigned(certFile, keyFile, "proxy.local")
+	if err != nil {
+		t.Fatalf("failed to generate certificate: %v", err)
+	}
+	if !generated {
+		t.Fatalf("expected certificate to be generated")
+	}
+
+	reloader, err := certs.NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("failed to load generated certificate: %v", err)
+	}
+	cert, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("failed to get certificate: %v", err)
+	}
+	if err := cert.Leaf.VerifyHostname("proxy.local"); err != nil {
+		t.Errorf("expected certificate for proxy.local: %v", err)
+	}
+
+	generated, err = certs.EnsureSelfSigned(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("failed to check certificate: %v", err)
+	}
+	if generated {
+		t.Errorf("expected existing certificate to be kept")
+	}
+}
+
+func TestReloader_PicksUpChangedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "dev.crt"), filepath.Join(dir, "dev.key")
+
+	if _, err := certs.EnsureSelfSigned(certFile, keyFile, "first.local"); err != nil {
+		t.Fatalf("failed to generate certificate: %v", err)
+	}
+	reloader, err := certs.NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("failed to load certificate: %v", err)
+	}
+
+	os.Remove(certFile)
+	if _, err := certs.EnsureSelfSigned(certFile, keyFile, "second.local"); err != nil {
+		t.Fatalf("failed to generate certificate: %v", err)
+	}
+	// File systems with coarse timestamps may not see the change otherwise.
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+
+	cert, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("failed to get certificate: %v", err)
+	}
+	if err := cert.Leaf.VerifyHostname("second.local"); err != nil {
+		t.Errorf("expected renewed certificate to be served: %v", err)
+	}
+}
+
+func TestReloader_KeepsCertificateWhenFilesBreak(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "dev.crt"), filepath.Join(dir, "dev.key")
+
+	if _, err := certs.EnsureSelfSigned(certFile, keyFile); err != nil {
+		t.Fatalf("failed to generate certificate: %v", err)
+	}
+	reloader, err := certs.NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("failed to load certificate: %v", err)
+	}
+
+	os.WriteFile(certFile, []byte("not a certificate"), 0o644)
+
+	if _, err := reloader.GetCertificate(nil); err != nil {
+		t.Errorf("expected previous certificate to be served, got error: %v", err)
+	}
+}
+
+func TestCA_PersistsAndIssuesCachedCertificates(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+
+	ca, err := certs.LoadOrCreateCA(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca.CertPEM()) {
+		t.Fatalf("failed to parse CA certificate")
+	}
+
+	for _, host := range []string{"example.com", "10.0.0.1"} {
+		cert, err := ca.Certificate(host)
+		if err != nil {
+			t.Fatalf("failed to issue certificate for %s: %v", host, err)
+		}
+		if _, err := cert.Leaf.Verify(x509.VerifyOptions{Roots: roots, DNSName: host}); err != nil {
+			t.Errorf("expected certificate for %s to verify: %v", host, err)
+		}
+	}
+
+	first, _ := ca.Certificate("example.com")
+	second, _ := ca.Certificate("example.com")
+	if first != second {
+		t.Errorf("expected issued certificate to be cached")
+	}
+
+	reloaded, err := certs.LoadOrCreateCA(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("failed to load CA: %v", err)
+	}
+	if string(reloaded.CertPEM()) != string(ca.CertPEM()) {
+		t.Errorf("expected the persisted CA to be loaded instead of a new one")
+	}
+}
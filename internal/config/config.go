@@ -1,8 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 )
@@ -17,20 +20,170 @@ func getStringOrDefault(name, def string) string {
 	return strings.TrimSpace(value)
 }
 
+func getBoolOrDefault(name string, def bool) (bool, error) {
+	value := getStringOrDefault(name, "")
+	if value == "" {
+		return def, nil
+	}
+
+	res, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", name, err)
+	}
+
+	return res, nil
+}
+
 type Config struct {
 	Port       string
 	ConfigPath string
 	DBPath     string
 	AuthToken  string
 	Retention  int
-	Proxies    []Proxy `toml:"proxy"`
+
+	// TLS of the ProxyMini listener. Port serves HTTPS when TLSCertFile and TLSKeyFile are set.
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSSelfSigned bool
+	// HTTPPort is an additional plain HTTP listener next to HTTPS, which redirects to HTTPS if HTTPSRedirect is set.
+	HTTPPort      string
+	HTTPSRedirect bool
+
+	// MaxCaptureBytes is the default number of body bytes kept in request logs, see Proxy.MaxCaptureBytes.
+	MaxCaptureBytes int
+	Forwarding      Forwarding   `toml:"forwarding"`
+	ForwardProxy    ForwardProxy `toml:"forwardProxy"`
+	Proxies         []Proxy      `toml:"proxy"`
+}
+
+// Forwarding configures the headers that tell upstreams about the client and the proxies in between.
+// It is read on startup only.
+type Forwarding struct {
+	// XForwarded adds X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Host.
+	XForwarded bool `toml:"xForwarded"`
+	// Forwarded adds the standard Forwarded header, see RFC 7239.
+	Forwarded bool `toml:"forwarded"`
+	// Via adds Via to requests and responses, see RFC 9110, section 7.6.3.
+	Via bool `toml:"via"`
+	// TrustedProxies are the IPs and CIDR ranges of proxies in front of ProxyMini. Forwarding headers are only kept
+	// from requests sent by them, and are replaced for other clients, so clients can't spoof their address.
+	TrustedProxies []string `toml:"trustedProxies"`
+}
+
+// ForwardProxy configures ProxyMini as a forward proxy for clients that use it as HTTP_PROXY or HTTPS_PROXY.
+// It is read on startup only.
+type ForwardProxy struct {
+	Enabled               bool `toml:"enabled"`
+	SkipLogging           bool `toml:"skipLogging"`
+	InsecureTLSSkipVerify bool `toml:"insecureTLSSkipVerify"`
+
+	// MITM decrypts CONNECT tunnels with certificates issued by a local CA, which is generated at CACert and CAKey
+	// on first start.
+	MITM   bool   `toml:"mitm"`
+	CACert string `toml:"caCert"`
+	CAKey  string `toml:"caKey"`
 }
 
 type Proxy struct {
-	Prefix                string `toml:"prefix"`
-	Target                string `toml:"target"`
-	SkipLogging           bool   `toml:"skipLogging"`
-	InsecureTLSSkipVerify bool   `toml:"insecureTLSSkipVerify"`
+	Host                  string         `toml:"host"`
+	Prefix                string         `toml:"prefix"`
+	PathRegex             string         `toml:"pathRegex"`
+	Target                string         `toml:"target"`
+	Targets               []Target       `toml:"targets"`
+	Strategy              string         `toml:"strategy"`
+	HashOn                string         `toml:"hashOn"`
+	Priority              int            `toml:"priority"` // Breaks ties between equal prefixes or between regex routes, never lifts a prefix route over a regex route.
+	SkipLogging           bool           `toml:"skipLogging"`
+	MaxCaptureBytes       int            `toml:"maxCaptureBytes"`
+	StreamContentTypes    []string       `toml:"streamContentTypes"`
+	SkipChunkedStreams    bool           `toml:"skipChunkedStreams"`
+	Protocol              string         `toml:"protocol"`
+	Protosets             []string       `toml:"protosets"`
+	InsecureTLSSkipVerify bool           `toml:"insecureTLSSkipVerify"`
+	CAFile                string         `toml:"caFile"`
+	ClientCertFile        string         `toml:"clientCertFile"`
+	ClientKeyFile         string         `toml:"clientKeyFile"`
+	ServerName            string         `toml:"serverName"`
+	MinTLSVersion         string         `toml:"minTLSVersion"`
+	UpstreamProxy         string         `toml:"upstreamProxy"`
+	DialTimeout           time.Duration  `toml:"dialTimeout"`
+	TLSHandshakeTimeout   time.Duration  `toml:"tlsHandshakeTimeout"`
+	ResponseHeaderTimeout time.Duration  `toml:"responseHeaderTimeout"`
+	TotalTimeout          time.Duration  `toml:"totalTimeout"`
+	Match                 Match          `toml:"match"`
+	HealthCheck           HealthCheck    `toml:"healthCheck"`
+	CircuitBreaker        CircuitBreaker `toml:"circuitBreaker"`
+	Retry                 Retry          `toml:"retry"`
+	RequestHeaders        HeaderRules    `toml:"requestHeaders"`
+	ResponseHeaders       HeaderRules    `toml:"responseHeaders"`
+	Rewrite               Rewrite        `toml:"rewrite"`
+}
+
+// Target is one of several upstreams of a proxy route.
+type Target struct {
+	URL    string `toml:"url"`
+	Weight int    `toml:"weight"`
+}
+
+// HealthCheck configures active health checks of the targets of a proxy route.
+type HealthCheck struct {
+	Path           string        `toml:"path"`
+	Interval       time.Duration `toml:"interval"` // Raised to 5s, the tick of the health check scheduler, when shorter. Default is 10s.
+	Timeout        time.Duration `toml:"timeout"`
+	ExpectedStatus int           `toml:"expectedStatus"`
+}
+
+// CircuitBreaker configures passive ejection of targets after consecutive failures.
+type CircuitBreaker struct {
+	FailureThreshold int           `toml:"failureThreshold"`
+	Cooldown         time.Duration `toml:"cooldown"`
+}
+
+// Retry configures retries of failed requests to the targets of a proxy route.
+type Retry struct {
+	MaxAttempts             int           `toml:"maxAttempts"`
+	RetryOnStatus           []int         `toml:"retryOnStatus"`
+	RetryOnConnectionErrors bool          `toml:"retryOnConnectionErrors"`
+	Backoff                 time.Duration `toml:"backoff"`
+	MaxBackoff              time.Duration `toml:"maxBackoff"`
+	AllowNonIdempotent      bool          `toml:"allowNonIdempotent"`
+}
+
+// HeaderRules modifies the headers of requests to targets or of responses to clients.
+type HeaderRules struct {
+	Set    map[string]string `toml:"set"`
+	Add    map[string]string `toml:"add"`
+	Remove []string          `toml:"remove"`
+}
+
+// Rewrite configures how the path and query of a request are changed before it is sent to a target.
+type Rewrite struct {
+	KeepPrefix    bool           `toml:"keepPrefix"`
+	ReplacePrefix string         `toml:"replacePrefix"`
+	AddPrefix     string         `toml:"addPrefix"`
+	Regex         []RegexRewrite `toml:"regex"`
+	Query         QueryRewrite   `toml:"query"`
+}
+
+// RegexRewrite replaces every match of Pattern in the path with Replacement, which can reference capture groups.
+type RegexRewrite struct {
+	Pattern     string `toml:"pattern"`
+	Replacement string `toml:"replacement"`
+}
+
+// QueryRewrite changes the query parameters of a request.
+type QueryRewrite struct {
+	Add    map[string]string `toml:"add"`
+	Remove []string          `toml:"remove"`
+	Rename map[string]string `toml:"rename"`
+}
+
+// Match holds additional request conditions a proxy route must satisfy besides host and path.
+type Match struct {
+	Methods     []string          `toml:"methods"`
+	Headers     map[string]string `toml:"headers"`
+	HeaderRegex map[string]string `toml:"headerRegex"`
+	Query       []string          `toml:"query"`
 }
 
 func New() (*Config, error) {
@@ -40,6 +193,22 @@ func New() (*Config, error) {
 	config.ConfigPath = getStringOrDefault("PROXYMINI_CONFIG", "proxymini.conf.toml")
 	config.DBPath = getStringOrDefault("PROXYMINI_DB", "rl.db")
 	config.AuthToken = getStringOrDefault("PROXYMINI_AUTH_TOKEN", "")
+	config.TLSCertFile = getStringOrDefault("PROXYMINI_TLS_CERT", "")
+	config.TLSKeyFile = getStringOrDefault("PROXYMINI_TLS_KEY", "")
+	config.HTTPPort = getStringOrDefault("PROXYMINI_HTTP_PORT", "")
+
+	var err error
+	if config.TLSSelfSigned, err = getBoolOrDefault("PROXYMINI_TLS_SELF_SIGNED", false); err != nil {
+		return nil, err
+	}
+	if config.HTTPSRedirect, err = getBoolOrDefault("PROXYMINI_HTTPS_REDIRECT", false); err != nil {
+		return nil, err
+	}
+	// A self-signed certificate is generated at the default paths unless others are given.
+	if config.TLSSelfSigned {
+		config.TLSCertFile = getStringOrDefault("PROXYMINI_TLS_CERT", "proxymini.crt")
+		config.TLSKeyFile = getStringOrDefault("PROXYMINI_TLS_KEY", "proxymini.key")
+	}
 
 	data, err := os.ReadFile(config.ConfigPath)
 	if err != nil {
@@ -51,6 +220,13 @@ func New() (*Config, error) {
 		return nil, err
 	}
 
+	if config.ForwardProxy.CACert == "" {
+		config.ForwardProxy.CACert = "proxymini-ca.crt"
+	}
+	if config.ForwardProxy.CAKey == "" {
+		config.ForwardProxy.CAKey = "proxymini-ca.key"
+	}
+
 	return &config, nil
 }
 
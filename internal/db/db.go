@@ -2,11 +2,41 @@ package db
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/jmoiron/sqlx"
 	_ "modernc.org/sqlite"
 )
 
+// addedRequestLogColumns are request_log columns introduced after the table was first created.
+// Databases created by older versions get them on startup.
+var addedRequestLogColumns = []struct{ name, definition string }{
+	{"upstream", "TEXT NOT NULL DEFAULT ''"},
+	{"attempt", "INT NOT NULL DEFAULT 1"},
+	{"error", "TEXT NOT NULL DEFAULT ''"},
+	{"timed_out", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"request_body_size", "BIGINT NOT NULL DEFAULT 0"},
+	{"request_body_truncated", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"response_body_size", "BIGINT NOT NULL DEFAULT 0"},
+	{"response_body_truncated", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"streaming", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"request_content_type", "TEXT NOT NULL DEFAULT ''"},
+	{"request_encoding", "TEXT NOT NULL DEFAULT ''"},
+	{"response_content_type", "TEXT NOT NULL DEFAULT ''"},
+	{"response_encoding", "TEXT NOT NULL DEFAULT ''"},
+	{"response_body_decoded", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"response_body_encoded_size", "BIGINT NOT NULL DEFAULT 0"},
+	{"protocol", "TEXT NOT NULL DEFAULT ''"},
+	{"upstream_protocol", "TEXT NOT NULL DEFAULT ''"},
+	{"grpc_status", "TEXT NOT NULL DEFAULT ''"},
+	{"grpc_message", "TEXT NOT NULL DEFAULT ''"},
+	{"request_messages", "TEXT NOT NULL DEFAULT ''"},
+	{"response_messages", "TEXT NOT NULL DEFAULT ''"},
+	{"tunnel", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"upstream_proxy", "TEXT NOT NULL DEFAULT ''"},
+	{"upstream_proxy_failed", "BOOLEAN NOT NULL DEFAULT FALSE"},
+}
+
 func Connect(name string) (*sqlx.DB, error) {
 	return sqlx.Connect("sqlite", name)
 }
@@ -20,20 +50,112 @@ CREATE TABLE IF NOT EXISTS request_log (
     method TEXT,  
     proxy_url TEXT,
     url TEXT,               
+    upstream TEXT NOT NULL DEFAULT '',
+    attempt INT NOT NULL DEFAULT 1,
+    error TEXT NOT NULL DEFAULT '',
+    timed_out BOOLEAN NOT NULL DEFAULT FALSE,
     request_headers TEXT,   
-    request_body TEXT,      
+    request_body BLOB,
     status INT NOT NULL,    
     response_headers TEXT,  
-    response_body TEXT      
+    response_body BLOB,
+    request_body_size BIGINT NOT NULL DEFAULT 0,
+    request_body_truncated BOOLEAN NOT NULL DEFAULT FALSE,
+    response_body_size BIGINT NOT NULL DEFAULT 0,
+    response_body_truncated BOOLEAN NOT NULL DEFAULT FALSE,
+    streaming BOOLEAN NOT NULL DEFAULT FALSE,
+    request_content_type TEXT NOT NULL DEFAULT '',
+    request_encoding TEXT NOT NULL DEFAULT '',
+    response_content_type TEXT NOT NULL DEFAULT '',
+    response_encoding TEXT NOT NULL DEFAULT '',
+    response_body_decoded BOOLEAN NOT NULL DEFAULT FALSE,
+    response_body_encoded_size BIGINT NOT NULL DEFAULT 0,
+    protocol TEXT NOT NULL DEFAULT '',
+    upstream_protocol TEXT NOT NULL DEFAULT '',
+    grpc_status TEXT NOT NULL DEFAULT '',
+    grpc_message TEXT NOT NULL DEFAULT '',
+    request_messages TEXT NOT NULL DEFAULT '',
+    response_messages TEXT NOT NULL DEFAULT '',
+    tunnel BOOLEAN NOT NULL DEFAULT FALSE,
+    upstream_proxy TEXT NOT NULL DEFAULT '',
+    upstream_proxy_failed BOOLEAN NOT NULL DEFAULT FALSE
 );`)
 	if err != nil {
 		return fmt.Errorf("create request_log table: %w", err)
 	}
 
+	for _, column := range addedRequestLogColumns {
+		if err := addColumnIfMissing(db, "request_log", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+
 	// Create index on time column for efficient log retention cleanup
 	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_request_log_time ON request_log(time)"); err != nil {
 		return fmt.Errorf("create index on request_log.time: %w", err)
 	}
 
+	_, err = db.Exec(`
+CREATE TABLE IF NOT EXISTS websocket_frame (
+    id INTEGER PRIMARY KEY,
+    request_log_id TEXT NOT NULL,
+    time_ms BIGINT NOT NULL,
+    direction TEXT NOT NULL,
+    opcode INT NOT NULL,
+    size BIGINT NOT NULL,
+    payload BLOB NOT NULL,
+    truncated BOOLEAN NOT NULL DEFAULT FALSE
+);`)
+	if err != nil {
+		return fmt.Errorf("create websocket_frame table: %w", err)
+	}
+
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_websocket_frame_request_log_id ON websocket_frame(request_log_id)"); err != nil {
+		return fmt.Errorf("create index on websocket_frame.request_log_id: %w", err)
+	}
+
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_websocket_frame_time_ms ON websocket_frame(time_ms)"); err != nil {
+		return fmt.Errorf("create index on websocket_frame.time_ms: %w", err)
+	}
+
+	_, err = db.Exec(`
+CREATE TABLE IF NOT EXISTS stream_event (
+    id INTEGER PRIMARY KEY,
+    request_log_id TEXT NOT NULL,
+    time_ms BIGINT NOT NULL,
+    size BIGINT NOT NULL,
+    data BLOB NOT NULL,
+    truncated BOOLEAN NOT NULL DEFAULT FALSE
+);`)
+	if err != nil {
+		return fmt.Errorf("create stream_event table: %w", err)
+	}
+
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_stream_event_request_log_id ON stream_event(request_log_id)"); err != nil {
+		return fmt.Errorf("create index on stream_event.request_log_id: %w", err)
+	}
+
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_stream_event_time_ms ON stream_event(time_ms)"); err != nil {
+		return fmt.Errorf("create index on stream_event.time_ms: %w", err)
+	}
+
+	return nil
+}
+
+// addColumnIfMissing adds a column to an existing table, so databases created by older versions keep working.
+func addColumnIfMissing(db *sqlx.DB, table, column, definition string) error {
+	var columns []string
+	if err := db.Select(&columns, "SELECT name FROM pragma_table_info(?)", table); err != nil {
+		return fmt.Errorf("get %s columns: %w", table, err)
+	}
+
+	if slices.Contains(columns, column) {
+		return nil
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("add column %s.%s: %w", table, column, err)
+	}
+
 	return nil
 }
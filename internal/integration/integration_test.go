@@ -1,16 +1,22 @@
 package tests_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/jmoiron/sqlx"
+	"github.com/klauspost/compress/zstd"
 	"github.com/mishankov/proxymini/internal/config"
 	"github.com/mishankov/proxymini/internal/db"
 	"github.com/mishankov/proxymini/internal/proxy"
@@ -44,7 +50,7 @@ target = "` + upstream.URL + `"`
 	time.Sleep(50 * time.Millisecond)
 
 	logs, err := rlSvc.GetList()
-	if err == nil {
+	if err != nil {
 		t.Fatalf("failed to get logs: %v", err)
 	}
 
@@ -223,6 +229,450 @@ target = "` + upstream.URL + `"`
 	}
 }
 
+func TestProxyRequest_LogsContainUpstream(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	firstUpstream := newMockServer("first", http.StatusOK, nil)
+	defer firstUpstream.Close()
+
+	secondUpstream := newMockServer("second", http.StatusOK, nil)
+	defer secondUpstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+targets = [{ url = "` + firstUpstream.URL + `" }, { url = "` + secondUpstream.URL + `" }]`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	rlSvc := requestlog.NewRequestLogService(testDB)
+	proxyHandler := proxy.NewProxyHandler(rlSvc, conf)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		rr := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rr, req)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	logs, err := rlSvc.GetList()
+	if err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+
+	if len(logs) != 2 {
+		t.Fatalf("expected 2 logs, got %d", len(logs))
+	}
+
+	upstreams := map[string]bool{}
+	for _, log := range logs {
+		upstreams[log.Upstream] = true
+		if !strings.HasPrefix(log.URL, log.Upstream) {
+			t.Errorf("expected URL '%s' to start with upstream '%s'", log.URL, log.Upstream)
+		}
+	}
+
+	if !upstreams[firstUpstream.URL] || !upstreams[secondUpstream.URL] {
+		t.Errorf("expected both upstreams to be logged, got %v", upstreams)
+	}
+}
+
+func TestProxyRequest_RetryAttemptsLogged(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"
+
+[proxy.retry]
+maxAttempts = 2
+retryOnStatus = [502]
+backoff = "1ms"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	rlSvc := requestlog.NewRequestLogService(testDB)
+	proxyHandler := proxy.NewProxyHandler(rlSvc, conf)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, req)
+
+	time.Sleep(50 * time.Millisecond)
+
+	logs, err := rlSvc.GetList()
+	if err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+
+	if len(logs) != 2 {
+		t.Fatalf("expected 2 logs, got %d", len(logs))
+	}
+
+	attempts := map[int]requestlog.RequestLog{}
+	for _, log := range logs {
+		attempts[log.Attempt] = log
+	}
+
+	if attempts[1].Status != http.StatusBadGateway || attempts[1].Error == "" {
+		t.Errorf("expected first attempt to fail with status 502 and an error, got status %d and error '%s'", attempts[1].Status, attempts[1].Error)
+	}
+
+	if attempts[2].Status != http.StatusOK || attempts[2].Error != "" {
+		t.Errorf("expected second attempt to succeed, got status %d and error '%s'", attempts[2].Status, attempts[2].Error)
+	}
+}
+
+func TestProxyRequest_ConnectionErrorLogged(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	upstream := newMockServer("unused", http.StatusOK, nil)
+	upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	rlSvc := requestlog.NewRequestLogService(testDB)
+	proxyHandler := proxy.NewProxyHandler(rlSvc, conf)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, req)
+
+	time.Sleep(50 * time.Millisecond)
+
+	logs, err := rlSvc.GetList()
+	if err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 log, got %d", len(logs))
+	}
+
+	if logs[0].Status != 0 {
+		t.Errorf("expected Status 0 for a failed connection, got %d", logs[0].Status)
+	}
+
+	if !strings.Contains(logs[0].Error, "connection refused") {
+		t.Errorf("expected Error to mention the connection failure, got '%s'", logs[0].Error)
+	}
+
+	if logs[0].TimedOut {
+		t.Errorf("expected connection failure not to be marked as timed out")
+	}
+}
+
+func TestProxyRequest_TimeoutLogged(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"
+responseHeaderTimeout = "50ms"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	rlSvc := requestlog.NewRequestLogService(testDB)
+	proxyHandler := proxy.NewProxyHandler(rlSvc, conf)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, req)
+
+	time.Sleep(50 * time.Millisecond)
+
+	logs, err := rlSvc.GetList()
+	if err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 log, got %d", len(logs))
+	}
+
+	if !logs[0].TimedOut {
+		t.Errorf("expected log to be marked as timed out, got error '%s'", logs[0].Error)
+	}
+}
+
+func TestProxyRequest_LargeBodiesTruncatedInLog(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	responseBody := strings.Repeat("r", 50)
+	upstream := newMockServer(responseBody, http.StatusOK, nil)
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"
+maxCaptureBytes = 10`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+	conf.MaxCaptureBytes = 1000
+
+	rlSvc := requestlog.NewRequestLogService(testDB)
+	proxyHandler := proxy.NewProxyHandler(rlSvc, conf)
+
+	requestBody := strings.Repeat("q", 100)
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", strings.NewReader(requestBody))
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, req)
+
+	if rr.Body.String() != responseBody {
+		t.Errorf("expected the full response body to be proxied, got %d bytes", rr.Body.Len())
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	logs, err := rlSvc.GetList()
+	if err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 log, got %d", len(logs))
+	}
+
+	log := logs[0]
+	if log.RequestBody != requestBody[:10] || log.RequestBodySize != 100 || !log.RequestBodyTruncated {
+		t.Errorf("expected request body cut to 10 of 100 bytes, got %d of %d bytes (truncated: %v)", len(log.RequestBody), log.RequestBodySize, log.RequestBodyTruncated)
+	}
+	if log.ResponseBody != responseBody[:10] || log.ResponseBodySize != 50 || !log.ResponseBodyTruncated {
+		t.Errorf("expected response body cut to 10 of 50 bytes, got %d of %d bytes (truncated: %v)", len(log.ResponseBody), log.ResponseBodySize, log.ResponseBodyTruncated)
+	}
+}
+
+func TestProxyRequest_GlobalCaptureLimit(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	upstream := newMockServer("short", http.StatusOK, nil)
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+	conf.MaxCaptureBytes = 4
+
+	rlSvc := requestlog.NewRequestLogService(testDB)
+	proxyHandler := proxy.NewProxyHandler(rlSvc, conf)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", strings.NewReader("abc"))
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, req)
+
+	time.Sleep(50 * time.Millisecond)
+
+	logs, err := rlSvc.GetList()
+	if err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 log, got %d", len(logs))
+	}
+
+	if logs[0].RequestBody != "abc" || logs[0].RequestBodyTruncated {
+		t.Errorf("expected request body within the limit to be kept, got '%s'", logs[0].RequestBody)
+	}
+	if logs[0].ResponseBody != "shor" || logs[0].ResponseBodySize != 5 || !logs[0].ResponseBodyTruncated {
+		t.Errorf("expected response body cut to 'shor' of 5 bytes, got '%s' of %d bytes", logs[0].ResponseBody, logs[0].ResponseBodySize)
+	}
+}
+
+func TestProxyRequest_EventStreamLoggedWhileLive(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+	// Logs and events are saved from different goroutines, keep them on the same in-memory database.
+	testDB.SetMaxOpenConns(1)
+
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: first\n\n"))
+		w.(http.Flusher).Flush()
+
+		<-release
+		w.Write([]byte("data: second\n\n"))
+	}))
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	rlSvc := requestlog.NewRequestLogService(testDB)
+	proxyServer := httptest.NewServer(proxy.NewProxyHandler(rlSvc, conf))
+	defer proxyServer.Close()
+
+	resp, err := http.Get(proxyServer.URL + "/api/stream")
+	if err != nil {
+		t.Fatalf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	first := make([]byte, len("data: first\n\n"))
+	if _, err := io.ReadFull(resp.Body, first); err != nil {
+		t.Fatalf("failed to read first event: %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	logs, err := rlSvc.GetList()
+	if err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("expected the log to be saved when the stream starts, got %d logs", len(logs))
+	}
+	if !logs[0].Streaming {
+		t.Errorf("expected log to be marked as streaming")
+	}
+
+	events, err := rlSvc.GetEvents(logs[0].ID)
+	if err != nil {
+		t.Fatalf("failed to get events: %v", err)
+	}
+	if len(events) != 1 || events[0].Data != "data: first" {
+		t.Fatalf("expected the first event while the stream is live, got %+v", events)
+	}
+
+	close(release)
+	io.ReadAll(resp.Body)
+
+	time.Sleep(50 * time.Millisecond)
+
+	events, err = rlSvc.GetEvents(logs[0].ID)
+	if err != nil {
+		t.Fatalf("failed to get events: %v", err)
+	}
+	if len(events) != 2 || events[1].Data != "data: second" {
+		t.Errorf("expected both events after the stream ended, got %+v", events)
+	}
+
+	logs, err = rlSvc.GetList()
+	if err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("expected the log to be updated when the stream ends, got %d logs", len(logs))
+	}
+	if logs[0].ResponseBody != "data: first\n\ndata: second\n\n" {
+		t.Errorf("expected the whole stream in the response body, got '%s'", logs[0].ResponseBody)
+	}
+}
+
+func TestProxyRequest_StreamsDetected(t *testing.T) {
+	tests := []struct {
+		name              string
+		contentType       string
+		skipChunked       bool
+		expectedStreaming bool
+	}{
+		{"chunked JSON", "application/json", false, true},
+		{"chunked JSON with skipChunkedStreams", "application/json", true, false},
+		{"NDJSON with skipChunkedStreams", "application/x-ndjson", true, true},
+		{"configured content type with skipChunkedStreams", "application/stream+json", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB, cleanupDB := setupTestDB()
+			defer cleanupDB()
+			testDB.SetMaxOpenConns(1)
+
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				// Flushing before the end makes the response chunked.
+				w.Write([]byte(`{"part":1}` + "\n"))
+				w.(http.Flusher).Flush()
+				w.Write([]byte(`{"part":2}` + "\n"))
+			}))
+			defer upstream.Close()
+
+			configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"
+streamContentTypes = ["application/stream+json"]
+skipChunkedStreams = ` + strconv.FormatBool(tt.skipChunked)
+
+			conf, cleanupConfig := createTestConfig(configContent)
+			defer cleanupConfig()
+
+			rlSvc := requestlog.NewRequestLogService(testDB)
+			proxyServer := httptest.NewServer(proxy.NewProxyHandler(rlSvc, conf))
+			defer proxyServer.Close()
+
+			resp, err := http.Get(proxyServer.URL + "/api/items")
+			if err != nil {
+				t.Fatalf("failed to make request: %v", err)
+			}
+			io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			time.Sleep(50 * time.Millisecond)
+
+			logs, err := rlSvc.GetList()
+			if err != nil {
+				t.Fatalf("failed to get logs: %v", err)
+			}
+			if len(logs) != 1 {
+				t.Fatalf("expected 1 log, got %d", len(logs))
+			}
+			if logs[0].Streaming != tt.expectedStreaming {
+				t.Errorf("expected streaming %v, got %v", tt.expectedStreaming, logs[0].Streaming)
+			}
+
+			events, err := rlSvc.GetEvents(logs[0].ID)
+			if err != nil {
+				t.Fatalf("failed to get events: %v", err)
+			}
+			if !tt.expectedStreaming && len(events) != 0 {
+				t.Errorf("expected no events for a plain response, got %d", len(events))
+			}
+		})
+	}
+}
+
 func TestProxyRequest_SkipLoggingPreventsLogCreation(t *testing.T) {
 	testDB, cleanupDB := setupTestDB()
 	defer cleanupDB()
@@ -434,3 +884,164 @@ func createTestConfig(content string) (*config.Config, func()) {
 
 	return conf, cleanup
 }
+
+func TestProxyRequest_CompressedResponseDecodedInLog(t *testing.T) {
+	const text = `{"message":"hello, compressed world"}`
+
+	tests := []struct {
+		encoding string
+		encode   func(w io.Writer) io.WriteCloser
+	}{
+		{"gzip", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+		{"deflate", func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }},
+		{"br", func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) }},
+		{"zstd", func(w io.Writer) io.WriteCloser { zw, _ := zstd.NewWriter(w); return zw }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			testDB, cleanupDB := setupTestDB()
+			defer cleanupDB()
+
+			var encoded bytes.Buffer
+			ew := tt.encode(&encoded)
+			ew.Write([]byte(text))
+			ew.Close()
+
+			upstream := newMockServer(encoded.String(), http.StatusOK, http.Header{
+				"Content-Type":     []string{"application/json"},
+				"Content-Encoding": []string{tt.encoding},
+			})
+			defer upstream.Close()
+
+			configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"`
+
+			conf, cleanupConfig := createTestConfig(configContent)
+			defer cleanupConfig()
+
+			rlSvc := requestlog.NewRequestLogService(testDB)
+			proxyHandler := proxy.NewProxyHandler(rlSvc, conf)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/data", nil)
+			req.Header.Set("Accept-Encoding", tt.encoding)
+			rr := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rr, req)
+
+			if !bytes.Equal(rr.Body.Bytes(), encoded.Bytes()) {
+				t.Errorf("expected client to get the encoded body unchanged")
+			}
+
+			time.Sleep(50 * time.Millisecond)
+
+			logs, err := rlSvc.GetList()
+			if err != nil {
+				t.Fatalf("failed to get logs: %v", err)
+			}
+			if len(logs) != 1 {
+				t.Fatalf("expected 1 log, got %d", len(logs))
+			}
+
+			log := logs[0]
+			if log.ResponseBody != text || !log.ResponseBodyDecoded {
+				t.Errorf("expected decoded body '%s' in log, got '%s' (decoded: %v)", text, log.ResponseBody, log.ResponseBodyDecoded)
+			}
+			if log.ResponseEncoding != tt.encoding {
+				t.Errorf("expected encoding '%s', got '%s'", tt.encoding, log.ResponseEncoding)
+			}
+			if log.ResponseBodySize != int64(len(text)) || log.ResponseBodyEncodedSize != int64(encoded.Len()) {
+				t.Errorf("expected sizes %d decoded and %d encoded, got %d and %d", len(text), encoded.Len(), log.ResponseBodySize, log.ResponseBodyEncodedSize)
+			}
+		})
+	}
+}
+
+func TestProxyRequest_DecodingStopsAtCaptureLimit(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	// 64 MiB of zeros compress to a few dozen KiB.
+	const decodedSize = 64 << 20
+	var encoded bytes.Buffer
+	gw, _ := gzip.NewWriterLevel(&encoded, gzip.BestCompression)
+	gw.Write(make([]byte, decodedSize))
+	gw.Close()
+
+	upstream := newMockServer(encoded.String(), http.StatusOK, http.Header{"Content-Encoding": []string{"gzip"}})
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"
+maxCaptureBytes = 1024`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	rlSvc := requestlog.NewRequestLogService(testDB)
+	proxyHandler := proxy.NewProxyHandler(rlSvc, conf)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/bomb", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, req)
+
+	if !bytes.Equal(rr.Body.Bytes(), encoded.Bytes()) {
+		t.Errorf("expected client to get the encoded body unchanged")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	logs, err := rlSvc.GetList()
+	if err != nil || len(logs) != 1 {
+		t.Fatalf("expected 1 log, got %d (%v)", len(logs), err)
+	}
+
+	log := logs[0]
+	if !log.ResponseBodyDecoded || !log.ResponseBodyTruncated || len(log.ResponseBody) != 1024 {
+		t.Errorf("expected 1024 decoded bytes cut in the log, got %d (decoded: %v, truncated: %v)", len(log.ResponseBody), log.ResponseBodyDecoded, log.ResponseBodyTruncated)
+	}
+	if log.ResponseBodySize >= decodedSize {
+		t.Errorf("expected decoding to stop before the end of the body, decoded %d bytes", log.ResponseBodySize)
+	}
+	if log.ResponseBodyEncodedSize != int64(encoded.Len()) {
+		t.Errorf("expected encoded size %d, got %d", encoded.Len(), log.ResponseBodyEncodedSize)
+	}
+}
+
+func TestProxyRequest_UndecodableResponseLoggedAsProxied(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	upstream := newMockServer("not gzip at all", http.StatusOK, http.Header{"Content-Encoding": []string{"gzip"}})
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	rlSvc := requestlog.NewRequestLogService(testDB)
+	proxyHandler := proxy.NewProxyHandler(rlSvc, conf)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/data", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+	time.Sleep(50 * time.Millisecond)
+
+	logs, err := rlSvc.GetList()
+	if err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 log, got %d", len(logs))
+	}
+
+	if logs[0].ResponseBody != "not gzip at all" || logs[0].ResponseBodyDecoded {
+		t.Errorf("expected body that failed to decode to be logged as proxied, got '%s' (decoded: %v)", logs[0].ResponseBody, logs[0].ResponseBodyDecoded)
+	}
+}
@@ -0,0 +1,257 @@
+package proxy
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mishankov/proxymini/internal/config"
+)
+
+const (
+	strategyRoundRobin    = "round-robin"
+	strategyLeastInFlight = "least-in-flight"
+	strategyRandom        = "random"
+	strategyHash          = "hash"
+)
+
+// upstream is a target of a route together with its shared runtime state.
+type upstream struct {
+	url    string
+	weight int
+	state  *upstreamState
+}
+
+// upstreamPool keeps the state of all upstreams and round-robin counters of all routes
+// so that load balancing and health tracking keep working across config reloads.
+// Upstream state belongs to a route, so routes sharing a target keep their own health and circuit breaker.
+type upstreamPool struct {
+	mu       sync.Mutex
+	states   map[string]*upstreamState
+	counters map[string]*atomic.Uint64
+}
+
+func newUpstreamPool() *upstreamPool {
+	return &upstreamPool{
+		states:   map[string]*upstreamState{},
+		counters: map[string]*atomic.Uint64{},
+	}
+}
+
+// upstreams returns the upstreams of the route with their shared state.
+func (p *upstreamPool) upstreams(r *route) []upstream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	targets := r.targets()
+	res := make([]upstream, 0, len(targets))
+	for _, target := range targets {
+		key := upstreamKey(r, target.URL)
+		state, ok := p.states[key]
+		if !ok {
+			state = &upstreamState{}
+			p.states[key] = state
+		}
+
+		res = append(res, upstream{url: target.URL, weight: target.Weight, state: state})
+	}
+
+	return res
+}
+
+// prune drops the state and counters of routes and targets that are no longer configured.
+func (p *upstreamPool) prune(routes []*route) {
+	configured := map[string]bool{}
+	for _, r := range routes {
+		configured[r.key()] = true
+		for _, target := range r.targets() {
+			configured[upstreamKey(r, target.URL)] = true
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key := range p.states {
+		if !configured[key] {
+			delete(p.states, key)
+		}
+	}
+	for key := range p.counters {
+		if !configured[key] {
+			delete(p.counters, key)
+		}
+	}
+}
+
+// upstreamKey identifies the state of a target of a route.
+func upstreamKey(r *route, url string) string {
+	return r.key() + " " + url
+}
+
+func (p *upstreamPool) counter(key string) *atomic.Uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	counter, ok := p.counters[key]
+	if !ok {
+		counter = &atomic.Uint64{}
+		p.counters[key] = counter
+	}
+
+	return counter
+}
+
+// pick chooses an available upstream for the request according to the strategy of the route.
+// It returns false if every upstream of the route is unhealthy or ejected.
+func (p *upstreamPool) pick(r *route, req *http.Request) (upstream, bool) {
+	now := time.Now()
+
+	var candidates []upstream
+	for _, u := range p.upstreams(r) {
+		if u.state.available(now, r.HealthCheck.Path != "") {
+			candidates = append(candidates, u)
+		}
+	}
+
+	switch {
+	case len(candidates) == 0:
+		return upstream{}, false
+	case len(candidates) == 1:
+		return candidates[0], true
+	}
+
+	switch r.Strategy {
+	case strategyLeastInFlight:
+		return pickLeastInFlight(candidates), true
+	case strategyRandom:
+		return pickRandom(candidates), true
+	case strategyHash:
+		if key := hashKey(r.HashOn, req); key != "" {
+			return pickHash(candidates, key), true
+		}
+	}
+
+	return pickRoundRobin(candidates, p.counter(r.key()).Add(1)-1), true
+}
+
+// pickRoundRobin walks the upstreams in order, giving each as many turns in a row as its weight.
+func pickRoundRobin(candidates []upstream, n uint64) upstream {
+	total := 0
+	for _, c := range candidates {
+		total += c.weight
+	}
+
+	pos := int(n % uint64(total))
+	for _, c := range candidates {
+		if pos < c.weight {
+			return c
+		}
+		pos -= c.weight
+	}
+
+	return candidates[0]
+}
+
+// pickLeastInFlight returns the upstream with the lowest number of in-flight requests per unit of weight.
+func pickLeastInFlight(candidates []upstream) upstream {
+	best := candidates[0]
+	for _, c := range candidates[1:] {
+		if c.state.inFlight.Load()*int64(best.weight) < best.state.inFlight.Load()*int64(c.weight) {
+			best = c
+		}
+	}
+
+	return best
+}
+
+func pickRandom(candidates []upstream) upstream {
+	total := 0
+	for _, c := range candidates {
+		total += c.weight
+	}
+
+	pos := rand.IntN(total)
+	for _, c := range candidates {
+		if pos < c.weight {
+			return c
+		}
+		pos -= c.weight
+	}
+
+	return candidates[0]
+}
+
+// pickHash uses weighted rendezvous hashing, so a key keeps going to the same upstream
+// and only the keys of a removed upstream move when the target list changes.
+func pickHash(candidates []upstream, key string) upstream {
+	best := candidates[0]
+	bestScore := math.Inf(-1)
+	for _, c := range candidates {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte(c.url))
+
+		// Map the hash to (0, 1) and weight it, see "Weighted rendezvous hashing".
+		unit := (float64(h.Sum64()>>11) + 0.5) / (1 << 53)
+		score := -float64(c.weight) / math.Log(unit)
+		if score > bestScore {
+			best, bestScore = c, score
+		}
+	}
+
+	return best
+}
+
+// hashKey extracts the value to hash on from the request. hashOn has the form "header:<name>" or "cookie:<name>".
+func hashKey(hashOn string, req *http.Request) string {
+	kind, name, _ := strings.Cut(hashOn, ":")
+
+	switch kind {
+	case "header":
+		return req.Header.Get(name)
+	case "cookie":
+		cookie, err := req.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	}
+
+	return ""
+}
+
+// validateBalancing checks the load balancing settings of a proxy entry.
+func validateBalancing(proxy config.Proxy) error {
+	switch proxy.Strategy {
+	case "", strategyRoundRobin, strategyLeastInFlight, strategyRandom:
+	case strategyHash:
+		kind, name, _ := strings.Cut(proxy.HashOn, ":")
+		if (kind != "header" && kind != "cookie") || name == "" {
+			return fmt.Errorf("invalid hashOn %q: expected header:<name> or cookie:<name>", proxy.HashOn)
+		}
+	default:
+		return fmt.Errorf("unknown strategy %q", proxy.Strategy)
+	}
+
+	if proxy.Target == "" && len(proxy.Targets) == 0 {
+		return fmt.Errorf("target is required")
+	}
+
+	for _, target := range proxy.Targets {
+		if target.URL == "" {
+			return fmt.Errorf("target url is required")
+		}
+		if target.Weight < 0 {
+			return fmt.Errorf("target %s: weight must not be negative", target.URL)
+		}
+	}
+
+	return nil
+}
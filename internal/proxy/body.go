@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/mishankov/proxymini/internal/utils"
+)
+
+const (
+	// defaultMaxCaptureBytes is the number of body bytes kept in the request log unless configured otherwise.
+	defaultMaxCaptureBytes = 1 << 20
+	// maxReplayBytes is the size up to which request bodies are buffered, so that failed attempts can be retried.
+	maxReplayBytes = 1 << 20
+)
+
+// requestBody streams the body of an incoming request to the upstream and captures its beginning for the log.
+// Small bodies of requests that may be retried are buffered completely, so every attempt can send them again.
+type requestBody struct {
+	src           io.Reader
+	contentLength int64
+	buffered      []byte
+	replayable    bool
+	capture       *utils.LimitedBuffer
+}
+
+func newRequestBody(r *http.Request, replay bool, captureLimit int) (*requestBody, error) {
+	b := &requestBody{
+		src:           r.Body,
+		contentLength: r.ContentLength,
+		capture:       &utils.LimitedBuffer{Limit: captureLimit},
+	}
+
+	if !replay {
+		return b, nil
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(r.Body, maxReplayBytes+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf) > maxReplayBytes {
+		b.src = io.MultiReader(bytes.NewReader(buf), r.Body)
+		return b, nil
+	}
+
+	b.buffered = buf
+	b.replayable = true
+	b.capture.Write(buf)
+
+	return b, nil
+}
+
+// newUpstreamRequest creates the request to the upstream with the body of the incoming request.
+func (b *requestBody) newUpstreamRequest(ctx context.Context, method, targetURL string) (*http.Request, error) {
+	if b.replayable {
+		return http.NewRequestWithContext(ctx, method, targetURL, bytes.NewReader(b.buffered))
+	}
+
+	if b.contentLength == 0 {
+		return http.NewRequestWithContext(ctx, method, targetURL, http.NoBody)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, targetURL, io.TeeReader(b.src, b.capture))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = b.contentLength
+
+	return req, nil
+}
+
+// captureLimit returns the number of body bytes kept in the log for the route.
+func (ph *ProxyHandler) captureLimit(route *route) int {
+	switch {
+	case route.MaxCaptureBytes > 0:
+		return route.MaxCaptureBytes
+	case ph.config.MaxCaptureBytes > 0:
+		return ph.config.MaxCaptureBytes
+	}
+
+	return defaultMaxCaptureBytes
+}
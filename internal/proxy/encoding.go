@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/mishankov/proxymini/internal/utils"
+)
+
+// responseCapture is an io.Writer that captures the beginning of a response body for the log.
+// Bodies with a Content-Encoding it can decode are decoded as they are written, so the log gets readable bodies
+// while the client still gets the encoded bytes.
+type responseCapture struct {
+	encoded  *utils.LimitedBuffer
+	decoded  *utils.LimitedBuffer
+	decoder  *decodingWriter
+	decodeOK bool
+}
+
+func newResponseCapture(header http.Header, limit int) *responseCapture {
+	rc := &responseCapture{encoded: &utils.LimitedBuffer{Limit: limit}}
+
+	encoding := strings.ToLower(strings.TrimSpace(header.Get("Content-Encoding")))
+	if isDecodable(encoding) {
+		rc.decoded = &utils.LimitedBuffer{Limit: limit}
+		rc.decoder = newDecodingWriter(encoding, rc.decoded)
+	}
+
+	return rc
+}
+
+func (rc *responseCapture) Write(p []byte) (int, error) {
+	rc.encoded.Write(p)
+	if rc.decoder != nil {
+		rc.decoder.Write(p)
+	}
+
+	return len(p), nil
+}
+
+// close finishes decoding. It must be called once the whole body was written.
+func (rc *responseCapture) close() {
+	if rc.decoder != nil {
+		rc.decodeOK = rc.decoder.close() == nil
+	}
+}
+
+// body returns the captured body and whether it was decoded. A body that failed to decode is returned as it was proxied.
+func (rc *responseCapture) body() (*utils.LimitedBuffer, bool) {
+	if rc.decodeOK {
+		return rc.decoded, true
+	}
+
+	return rc.encoded, false
+}
+
+func isDecodable(encoding string) bool {
+	switch encoding {
+	case "gzip", "x-gzip", "br", "deflate", "zstd":
+		return true
+	}
+
+	return false
+}
+
+// errCaptureFull stops decoding once the decoded body no longer fits in the capture buffer.
+var errCaptureFull = errors.New("capture buffer is full")
+
+// captureWriter writes to a capture buffer and fails with errCaptureFull once the buffer is full.
+type captureWriter struct {
+	buf *utils.LimitedBuffer
+}
+
+func (cw captureWriter) Write(p []byte) (int, error) {
+	cw.buf.Write(p)
+	if cw.buf.Truncated() {
+		return len(p), errCaptureFull
+	}
+
+	return len(p), nil
+}
+
+// decodingWriter decodes the bytes written to it into dst in a separate goroutine.
+// Writes never fail, so a body that can't be decoded doesn't interrupt proxying.
+// Decoding stops once dst is full, after which writes return immediately, so decompressing the body
+// doesn't slow down the response beyond the capture limit.
+type decodingWriter struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func newDecodingWriter(encoding string, dst *utils.LimitedBuffer) *decodingWriter {
+	pr, pw := io.Pipe()
+	dw := &decodingWriter{pw: pw, done: make(chan error, 1)}
+
+	go func() {
+		err := decode(encoding, captureWriter{buf: dst}, pr)
+		// Unblock writes if the decoder stopped before the end of the body.
+		pr.CloseWithError(fmt.Errorf("decoder stopped: %w", err))
+		if errors.Is(err, errCaptureFull) {
+			err = nil
+		}
+		dw.done <- err
+	}()
+
+	return dw
+}
+
+func (dw *decodingWriter) Write(p []byte) (int, error) {
+	dw.pw.Write(p)
+	return len(p), nil
+}
+
+// close signals the end of the body and returns the decoding error, if any.
+func (dw *decodingWriter) close() error {
+	dw.pw.Close()
+	return <-dw.done
+}
+
+// decode copies src decoded with the content encoding to dst.
+func decode(encoding string, dst io.Writer, src io.Reader) error {
+	var r io.Reader
+	switch encoding {
+	case "gzip", "x-gzip":
+		gr, err := gzip.NewReader(src)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	case "br":
+		r = brotli.NewReader(src)
+	case "deflate":
+		// "deflate" should be zlib-wrapped, but some servers send raw deflate data, see RFC 9110, section 8.4.1.2.
+		br := bufio.NewReader(src)
+		if header, err := br.Peek(2); err == nil && isZlibHeader(header) {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return err
+			}
+			defer zr.Close()
+			r = zr
+		} else {
+			fr := flate.NewReader(br)
+			defer fr.Close()
+			r = fr
+		}
+	case "zstd":
+		zr, err := zstd.NewReader(src, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+
+	_, err := io.Copy(dst, r)
+	return err
+}
+
+func isZlibHeader(header []byte) bool {
+	return header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0
+}
@@ -0,0 +1,299 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/mishankov/proxymini/internal/config"
+	"github.com/mishankov/proxymini/internal/requestlog"
+	"github.com/mishankov/proxymini/internal/utils"
+)
+
+// IsForwardProxyRequest reports whether the request is meant for a forward proxy:
+// a CONNECT request or a request with an absolute URI, such as "GET http://example.com/ HTTP/1.1".
+func IsForwardProxyRequest(r *http.Request) bool {
+	return r.Method == http.MethodConnect || r.URL.IsAbs()
+}
+
+// ServeForward proxies a forward proxy request to the origin in its URI, or tunnels a CONNECT request to its target.
+// When an auth token is configured, clients have to send it as the password of Proxy-Authorization.
+func (ph *ProxyHandler) ServeForward(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Proxy-Mini", "true")
+
+	if !ph.proxyAuthorized(r) {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="ProxyMini"`)
+		handleError(w, errors.New("proxy authentication required"), http.StatusProxyAuthRequired)
+		return
+	}
+
+	// Headers for the proxy itself are not passed on.
+	r = r.Clone(r.Context())
+	r.Header.Del("Proxy-Authorization")
+	r.Header.Del("Proxy-Connection")
+
+	if r.Method == http.MethodConnect {
+		ph.tunnel(w, r)
+		return
+	}
+
+	route := ph.forwardRoute(r.URL.Scheme + "://" + r.URL.Host)
+	body, err := newRequestBody(r, false, ph.captureLimit(route))
+	if err != nil {
+		handleError(w, fmt.Errorf("error reading request body: %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	ph.forward(w, r, route, body, 1, retryPolicy{})
+}
+
+func (ph *ProxyHandler) proxyAuthorized(r *http.Request) bool {
+	if ph.config.AuthToken == "" {
+		return true
+	}
+
+	// Basic credentials are parsed from Proxy-Authorization the way BasicAuth parses Authorization.
+	_, password, ok := (&http.Request{Header: http.Header{"Authorization": r.Header.Values("Proxy-Authorization")}}).BasicAuth()
+
+	return ok && subtle.ConstantTimeCompare([]byte(password), []byte(ph.config.AuthToken)) == 1
+}
+
+// forwardRoute returns a route that proxies requests unchanged to the origin.
+func (ph *ProxyHandler) forwardRoute(origin string) *route {
+	rw, _ := newRewriter(config.Rewrite{})
+
+	return &route{
+		Proxy: config.Proxy{
+			Target:                origin,
+			SkipLogging:           ph.config.ForwardProxy.SkipLogging,
+			InsecureTLSSkipVerify: ph.config.ForwardProxy.InsecureTLSSkipVerify,
+		},
+		index:    -1,
+		rewriter: rw,
+		forward:  true,
+	}
+}
+
+// pickUpstream chooses an upstream of the route. Forward proxy routes have the origin as their only upstream,
+// which is not tracked in the pool, as it would keep a state for every origin ever requested.
+func (ph *ProxyHandler) pickUpstream(route *route, r *http.Request) (upstream, bool) {
+	if route.forward {
+		return upstream{url: route.Target, weight: 1, state: &upstreamState{}}, true
+	}
+
+	return ph.upstreams.pick(route, r)
+}
+
+// tunnel connects the client to the target of a CONNECT request and relays bytes both ways until both sides are done.
+// The tunnel is logged when it is established and logged again with the relayed byte counts when it ends.
+// With MITM enabled, the tunnel is decrypted and the requests inside it are proxied instead, see intercept.
+func (ph *ProxyHandler) tunnel(w http.ResponseWriter, r *http.Request) {
+	startedAt := time.Now()
+	route := ph.forwardRoute("tcp://" + r.Host)
+
+	reqLog := requestlog.New(r.Method, r.Host, r.Host, r.Header, "", http.StatusOK, http.Header{}, "", 0)
+	reqLog.Upstream = r.Host
+	reqLog.Protocol = r.Proto
+	reqLog.Tunnel = true
+
+	if ph.ca != nil {
+		clientConn, err := acceptTunnel(w, r)
+		if err != nil {
+			handleError(w, fmt.Errorf("error accepting tunnel: %w", err), http.StatusInternalServerError)
+			return
+		}
+		defer clientConn.Close()
+
+		ph.intercept(r, route, reqLog, startedAt, clientConn)
+		return
+	}
+
+	// The target is dialed before the tunnel is accepted, so the client gets an error status if it is unreachable.
+	targetConn, err := ph.dialTunnel(r, route, reqLog, startedAt)
+	if err != nil {
+		handleError(w, err, http.StatusBadGateway)
+		return
+	}
+	defer targetConn.Close()
+
+	clientConn, err := acceptTunnel(w, r)
+	if err != nil {
+		handleError(w, fmt.Errorf("error accepting tunnel: %w", err), http.StatusInternalServerError)
+		return
+	}
+	defer clientConn.Close()
+
+	ph.relayTunnel(r, route, reqLog, startedAt, clientConn, targetConn)
+}
+
+// dialTunnel connects to the target of a CONNECT request. A failure is logged.
+func (ph *ProxyHandler) dialTunnel(r *http.Request, route *route, reqLog requestlog.RequestLog, startedAt time.Time) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: defaultDialTimeout}
+	targetConn, err := dialer.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		reqLog.Status = 0
+		reqLog.Error = err.Error()
+		reqLog.TimedOut = isTimeout(err)
+		reqLog.ElapsedMS = time.Since(startedAt).Milliseconds()
+		ph.saveLog(r, route, reqLog)
+		return nil, fmt.Errorf("error connecting to %s: %w", r.Host, err)
+	}
+
+	return targetConn, nil
+}
+
+// relayTunnel logs the established tunnel, relays it and updates the log with the byte counts when it ends.
+func (ph *ProxyHandler) relayTunnel(r *http.Request, route *route, reqLog requestlog.RequestLog, startedAt time.Time, clientConn, targetConn net.Conn) {
+	ph.saveLog(r, route, reqLog)
+
+	toTarget := &utils.LimitedBuffer{}
+	toClient := &utils.LimitedBuffer{}
+	err := relay(
+		func() error { return copyAndCloseWrite(targetConn, io.TeeReader(clientConn, toTarget)) },
+		func() error { return copyAndCloseWrite(clientConn, io.TeeReader(targetConn, toClient)) },
+	)
+
+	reqLog.ElapsedMS = time.Since(startedAt).Milliseconds()
+	reqLog.RequestBodySize = toTarget.Size()
+	reqLog.ResponseBodySize = toClient.Size()
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		reqLog.Error = err.Error()
+	}
+	ph.saveLog(r, route, reqLog)
+}
+
+// acceptTunnel answers a CONNECT request with 200 and returns the connection to the client.
+// HTTP/1.1 connections are hijacked. HTTP/2 connections can't be, so the tunnel is the CONNECT stream instead.
+func acceptTunnel(w http.ResponseWriter, r *http.Request) (net.Conn, error) {
+	rc := http.NewResponseController(w)
+
+	conn, buf, err := rc.Hijack()
+	if errors.Is(err, http.ErrNotSupported) {
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			return nil, err
+		}
+
+		return &streamConn{body: r.Body, w: w, rc: rc, remoteAddr: tunnelAddr(r.RemoteAddr), localAddr: tunnelAddr(r.Host)}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := buf.WriteString("HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := buf.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &bufferedConn{Conn: conn, r: buf.Reader}, nil
+}
+
+// relay runs both directions of a tunnel and returns the first error once both are done.
+func relay(directions ...func() error) error {
+	errc := make(chan error, len(directions))
+	for _, direction := range directions {
+		go func() { errc <- direction() }()
+	}
+
+	var res error
+	for range directions {
+		if err := <-errc; err != nil && res == nil {
+			res = err
+		}
+	}
+
+	return res
+}
+
+// copyAndCloseWrite copies src to dst and then closes the writing side of dst, so the peer sees the end of the stream
+// while the other direction keeps going. After an error, or for connections without half-close, dst is closed completely,
+// which ends the other direction too.
+func copyAndCloseWrite(dst io.Writer, src io.Reader) error {
+	_, err := io.Copy(dst, src)
+
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok && err == nil {
+		cw.CloseWrite()
+	} else if c, ok := dst.(io.Closer); ok {
+		c.Close()
+	}
+
+	return err
+}
+
+// bufferedConn is a connection whose reads go through a buffered reader, which may hold bytes already read from it.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c *bufferedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+
+	return c.Conn.Close()
+}
+
+// streamConn is a net.Conn over the request and response bodies of an HTTP/2 CONNECT stream.
+// The stream ends when the handler returns, so it can't be half-closed.
+type streamConn struct {
+	body       io.ReadCloser
+	w          io.Writer
+	rc         *http.ResponseController
+	remoteAddr net.Addr
+	localAddr  net.Addr
+	closed     atomic.Bool
+}
+
+func (c *streamConn) Read(p []byte) (int, error) {
+	n, err := c.body.Read(p)
+	if err != nil && c.closed.Load() {
+		err = net.ErrClosed
+	}
+
+	return n, err
+}
+
+func (c *streamConn) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	return n, c.rc.Flush()
+}
+
+func (c *streamConn) Close() error {
+	c.closed.Store(true)
+	return c.body.Close()
+}
+
+func (c *streamConn) LocalAddr() net.Addr  { return c.localAddr }
+func (c *streamConn) RemoteAddr() net.Addr { return c.remoteAddr }
+
+func (c *streamConn) SetDeadline(t time.Time) error {
+	return errors.Join(c.rc.SetReadDeadline(t), c.rc.SetWriteDeadline(t))
+}
+
+func (c *streamConn) SetReadDeadline(t time.Time) error  { return c.rc.SetReadDeadline(t) }
+func (c *streamConn) SetWriteDeadline(t time.Time) error { return c.rc.SetWriteDeadline(t) }
+
+// tunnelAddr is the address of a tunnel end as it is known from the CONNECT request.
+type tunnelAddr string
+
+func (a tunnelAddr) Network() string { return "tcp" }
+func (a tunnelAddr) String() string  { return string(a) }
@@ -0,0 +1,281 @@
+package proxy_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mishankov/proxymini/internal/certs"
+	"github.com/mishankov/proxymini/internal/proxy"
+	"github.com/mishankov/proxymini/internal/requestlog"
+)
+
+func TestForwardProxy_ProxiesAbsoluteURIRequests(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Connection") != "" {
+			t.Error("expected Proxy-Connection to be removed")
+		}
+		w.Write([]byte("hello from " + r.URL.Path))
+	}))
+	defer origin.Close()
+
+	conf, cleanupConfig := createTestConfig("")
+	defer cleanupConfig()
+
+	rlSvc := requestlog.NewRequestLogService(testDB)
+	handler := proxy.NewProxyHandler(rlSvc, conf)
+	proxyServer := httptest.NewServer(http.HandlerFunc(handler.ServeForward))
+	defer proxyServer.Close()
+
+	proxyURL, _ := url.Parse(proxyServer.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	resp, err := client.Get(origin.URL + "/greeting")
+	if err != nil {
+		t.Fatalf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hello from /greeting" {
+		t.Errorf("expected body 'hello from /greeting', got '%s'", string(body))
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	logs, err := rlSvc.GetList()
+	if err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 log, got %d", len(logs))
+	}
+	if logs[0].URL != origin.URL+"/greeting" {
+		t.Errorf("expected logged URL '%s', got '%s'", origin.URL+"/greeting", logs[0].URL)
+	}
+}
+
+func TestForwardProxy_TunnelsConnectRequests(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+	testDB.SetMaxOpenConns(1)
+
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	}))
+	defer origin.Close()
+
+	conf, cleanupConfig := createTestConfig("")
+	defer cleanupConfig()
+
+	rlSvc := requestlog.NewRequestLogService(testDB)
+	handler := proxy.NewProxyHandler(rlSvc, conf)
+	proxyServer := httptest.NewServer(http.HandlerFunc(handler.ServeForward))
+	defer proxyServer.Close()
+
+	proxyURL, _ := url.Parse(proxyServer.URL)
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:             http.ProxyURL(proxyURL),
+		TLSClientConfig:   &tls.Config{RootCAs: origin.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs},
+		DisableKeepAlives: true,
+	}}
+
+	resp, err := client.Get(origin.URL)
+	if err != nil {
+		t.Fatalf("failed to make request: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "secret" {
+		t.Errorf("expected body 'secret', got '%s'", string(body))
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	logs, err := rlSvc.GetList()
+	if err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 tunnel log, got %d", len(logs))
+	}
+
+	originHost := origin.Listener.Addr().String()
+	tunnel := logs[0]
+	if !tunnel.Tunnel || tunnel.Method != http.MethodConnect {
+		t.Errorf("expected a CONNECT tunnel log, got method '%s' with tunnel %v", tunnel.Method, tunnel.Tunnel)
+	}
+	if tunnel.URL != originHost {
+		t.Errorf("expected logged URL '%s', got '%s'", originHost, tunnel.URL)
+	}
+	if tunnel.RequestBodySize == 0 || tunnel.ResponseBodySize == 0 {
+		t.Errorf("expected relayed bytes in both directions, got %d and %d", tunnel.RequestBodySize, tunnel.ResponseBodySize)
+	}
+	if tunnel.RequestBody != "" || tunnel.ResponseBody != "" {
+		t.Error("expected tunneled bytes not to be kept in the log")
+	}
+}
+
+func TestForwardProxy_RequiresProxyAuthorization(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	origin := newMockServer("ok", http.StatusOK)
+	defer origin.Close()
+
+	conf, cleanupConfig := createTestConfig("")
+	defer cleanupConfig()
+	conf.AuthToken = "token"
+
+	handler := newTestProxyHandler(testDB, conf)
+	proxyServer := httptest.NewServer(http.HandlerFunc(handler.ServeForward))
+	defer proxyServer.Close()
+
+	tests := []struct {
+		name           string
+		user           *url.Userinfo
+		expectedStatus int
+	}{
+		{"no credentials", nil, http.StatusProxyAuthRequired},
+		{"wrong token", url.UserPassword("user", "wrong"), http.StatusProxyAuthRequired},
+		{"token", url.UserPassword("user", "token"), http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyURL, _ := url.Parse(proxyServer.URL)
+			proxyURL.User = tt.user
+			client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+			resp, err := client.Get(origin.URL)
+			if err != nil {
+				t.Fatalf("failed to make request: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if tt.expectedStatus == http.StatusProxyAuthRequired && resp.Header.Get("Proxy-Authenticate") == "" {
+				t.Error("expected Proxy-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestForwardProxy_MITMLogsRequestsInsideTunnels(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+	testDB.SetMaxOpenConns(1)
+
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte("got " + string(body)))
+	}))
+	defer origin.Close()
+
+	conf, cleanupConfig := createTestConfig("")
+	defer cleanupConfig()
+	// The test origin has a self-signed certificate.
+	conf.ForwardProxy.InsecureTLSSkipVerify = true
+
+	dir := t.TempDir()
+	ca, err := certs.LoadOrCreateCA(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"))
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+
+	rlSvc := requestlog.NewRequestLogService(testDB)
+	handler := proxy.NewProxyHandler(rlSvc, conf)
+	handler.EnableMITM(ca)
+	proxyServer := httptest.NewServer(http.HandlerFunc(handler.ServeForward))
+	defer proxyServer.Close()
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.CertPEM())
+	proxyURL, _ := url.Parse(proxyServer.URL)
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:             http.ProxyURL(proxyURL),
+		TLSClientConfig:   &tls.Config{RootCAs: roots},
+		ForceAttemptHTTP2: true,
+	}}
+
+	resp, err := client.Post(origin.URL+"/echo", "text/plain", strings.NewReader("ping"))
+	if err != nil {
+		t.Fatalf("failed to make request: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	client.CloseIdleConnections()
+
+	if string(body) != "got ping" {
+		t.Errorf("expected body 'got ping', got '%s'", string(body))
+	}
+	if resp.ProtoMajor != 2 {
+		t.Errorf("expected HTTP/2 inside the tunnel, got %s", resp.Proto)
+	}
+
+	// A client that doesn't trust the CA fails the handshake.
+	untrusted := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	if _, err := untrusted.Get(origin.URL); err == nil {
+		t.Errorf("expected a client without the CA to reject the certificate")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	logs, err := rlSvc.GetList()
+	if err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("expected 2 logs, got %d", len(logs))
+	}
+
+	var exchange, handshake requestlog.RequestLog
+	for _, l := range logs {
+		if l.Tunnel {
+			handshake = l
+		} else {
+			exchange = l
+		}
+	}
+
+	if exchange.Method != http.MethodPost || exchange.URL != origin.URL+"/echo" {
+		t.Errorf("expected the decrypted POST to %s/echo to be logged, got %s %s", origin.URL, exchange.Method, exchange.URL)
+	}
+	if exchange.RequestBody != "ping" || exchange.ResponseBody != "got ping" {
+		t.Errorf("expected decrypted bodies in the log, got '%s' and '%s'", exchange.RequestBody, exchange.ResponseBody)
+	}
+	if !strings.Contains(handshake.Error, "TLS handshake") {
+		t.Errorf("expected the failed handshake to be logged, got error '%s'", handshake.Error)
+	}
+}
+
+func TestCAHandler_ServesCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := certs.LoadOrCreateCA(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"))
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	proxy.NewCAHandler(ca).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/mitm/ca.crt", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if rec.Body.String() != string(ca.CertPEM()) {
+		t.Errorf("expected the CA certificate to be served")
+	}
+}
@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/mishankov/proxymini/internal/config"
+)
+
+// hopByHopHeaders describe a single connection and are not forwarded, see RFC 9110, section 7.6.1.
+// Proxy-Connection, Keep-Alive, TE, Trailer and Upgrade are listed as well, because old clients send them without
+// naming them in Connection.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopByHopHeaders removes the hop-by-hop headers and the headers named in Connection from h.
+func removeHopByHopHeaders(h http.Header) {
+	for _, value := range h.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+
+	for _, name := range hopByHopHeaders {
+		h.Del(name)
+	}
+}
+
+// forwarding adds the forwarding headers configured in config.Forwarding to upstream requests.
+type forwarding struct {
+	config.Forwarding
+	trusted []netip.Prefix
+}
+
+func newForwarding(conf config.Forwarding) (*forwarding, error) {
+	f := &forwarding{Forwarding: conf}
+
+	for _, proxy := range conf.TrustedProxies {
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			f.trusted = append(f.trusted, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		f.trusted = append(f.trusted, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+
+	return f, nil
+}
+
+// trusts reports whether ip belongs to a trusted proxy.
+func (f *forwarding) trusts(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range f.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP returns the IP of the client that sent the request. Behind trusted proxies, it is the last address
+// in X-Forwarded-For that doesn't belong to a trusted proxy, so the client can't make up its address.
+func (f *forwarding) clientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if !f.trusts(ip) {
+		return ip
+	}
+
+	chain := forwardedFor(r.Header)
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip = chain[i]
+		if !f.trusts(ip) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// apply adds the forwarding headers for the incoming request r to h, the headers of the upstream request.
+// The values sent by trusted proxies are extended, the ones sent by other clients are replaced.
+func (f *forwarding) apply(h http.Header, r *http.Request) {
+	peer := remoteIP(r)
+	trusted := f.trusts(peer)
+
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+
+	if f.XForwarded {
+		if !trusted {
+			h.Del("X-Forwarded-For")
+			h.Del("X-Forwarded-Proto")
+			h.Del("X-Forwarded-Host")
+		}
+
+		h.Set("X-Forwarded-For", strings.Join(append(forwardedFor(h), peer), ", "))
+		if h.Get("X-Forwarded-Proto") == "" {
+			h.Set("X-Forwarded-Proto", proto)
+		}
+		if h.Get("X-Forwarded-Host") == "" {
+			h.Set("X-Forwarded-Host", r.Host)
+		}
+	}
+
+	if f.Forwarded {
+		elements := h.Values("Forwarded")
+		if !trusted {
+			elements = nil
+		}
+
+		element := "for=" + forwardedNode(peer) + ";host=" + forwardedValue(r.Host) + ";proto=" + proto
+		h.Set("Forwarded", strings.Join(append(elements, element), ", "))
+	}
+
+	if f.Via {
+		h.Add("Via", via(r.ProtoMajor, r.ProtoMinor))
+	}
+}
+
+// forwardedFor returns the addresses listed in the X-Forwarded-For headers, from the client to the last proxy.
+func forwardedFor(h http.Header) []string {
+	var res []string
+	for _, value := range h.Values("X-Forwarded-For") {
+		for _, ip := range strings.Split(value, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				res = append(res, ip)
+			}
+		}
+	}
+
+	return res
+}
+
+// forwardedNode formats an IP as a node of the Forwarded header. IPv6 addresses are bracketed, see RFC 7239, section 6.
+func forwardedNode(ip string) string {
+	if strings.Contains(ip, ":") {
+		return `"[` + ip + `]"`
+	}
+
+	return forwardedValue(ip)
+}
+
+// forwardedValue quotes values of the Forwarded header that are not tokens, such as hosts with a port.
+func forwardedValue(value string) string {
+	if value == "" || strings.ContainsAny(value, `:[]"; ,=`) {
+		return strconv.Quote(value)
+	}
+
+	return value
+}
+
+// via returns the Via entry of ProxyMini for a message received with the given protocol version.
+func via(major, minor int) string {
+	if major >= 2 {
+		return strconv.Itoa(major) + " proxymini"
+	}
+
+	return fmt.Sprintf("%d.%d proxymini", major, minor)
+}
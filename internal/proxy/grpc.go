@@ -0,0 +1,223 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/mishankov/proxymini/internal/requestlog"
+)
+
+// grpcFrameHeaderSize is the size of the prefix of a gRPC message: a compressed flag and the message length,
+// see https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md.
+const grpcFrameHeaderSize = 5
+
+// grpcStatus returns the status code and message of a gRPC response. They are sent in the trailers,
+// or in the headers of responses without messages.
+func grpcStatus(resp *http.Response) (status, message string) {
+	for _, h := range []http.Header{resp.Trailer, resp.Header} {
+		if status := h.Get("Grpc-Status"); status != "" {
+			return status, decodeGRPCMessage(h.Get("Grpc-Message"))
+		}
+	}
+
+	return "", ""
+}
+
+// decodeGRPCMessage reverses the percent-encoding of grpc-message values.
+func decodeGRPCMessage(message string) string {
+	if decoded, err := url.PathUnescape(message); err == nil {
+		return decoded
+	}
+
+	return message
+}
+
+// logGRPC adds the gRPC status and the messages decoded with the descriptor sets of the route to the log.
+func (ph *ProxyHandler) logGRPC(reqLog *requestlog.RequestLog, route *route, methodPath string, header http.Header, resp *http.Response, requestBody, responseBody []byte) {
+	if resp != nil {
+		reqLog.GRPCStatus, reqLog.GRPCMessage = grpcStatus(resp)
+	}
+
+	if len(route.Protosets) == 0 {
+		return
+	}
+
+	method, types, err := ph.descriptors.findMethod(route.Protosets, methodPath)
+	var input, output protoreflect.MessageDescriptor
+	if err == nil {
+		input, output = method.Input(), method.Output()
+	}
+
+	reqLog.RequestMessages = decodeGRPCMessages(requestBody, input, types, header.Get("Grpc-Encoding"), err)
+	if resp != nil {
+		reqLog.ResponseMessages = decodeGRPCMessages(responseBody, output, types, resp.Header.Get("Grpc-Encoding"), err)
+	}
+}
+
+// grpcMessage is a message of a gRPC request or response as it is shown in the log.
+type grpcMessage struct {
+	Size       int             `json:"size"`
+	Compressed bool            `json:"compressed,omitempty"`
+	Message    json.RawMessage `json:"message,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// decodeGRPCMessages decodes the length-prefixed messages of a body into a JSON array.
+// Messages that can't be decoded are listed with the reason. A message cut by the capture limit ends the list.
+func decodeGRPCMessages(data []byte, msgType protoreflect.MessageDescriptor, types *dynamicpb.Types, encoding string, lookupErr error) string {
+	messages := []grpcMessage{}
+	for len(data) >= grpcFrameHeaderSize {
+		msg := grpcMessage{
+			Compressed: data[0] == 1,
+			Size:       int(binary.BigEndian.Uint32(data[1:grpcFrameHeaderSize])),
+		}
+		data = data[grpcFrameHeaderSize:]
+
+		if len(data) < msg.Size {
+			msg.Error = "message was cut in the log"
+			messages = append(messages, msg)
+			break
+		}
+
+		payload := data[:msg.Size]
+		data = data[msg.Size:]
+
+		msg.Message, msg.Error = decodeGRPCPayload(payload, msg.Compressed, msgType, types, encoding, lookupErr)
+		messages = append(messages, msg)
+	}
+
+	res, _ := json.Marshal(messages)
+	return string(res)
+}
+
+func decodeGRPCPayload(payload []byte, compressed bool, msgType protoreflect.MessageDescriptor, types *dynamicpb.Types, encoding string, lookupErr error) (json.RawMessage, string) {
+	if lookupErr != nil {
+		return nil, lookupErr.Error()
+	}
+
+	if compressed {
+		if encoding != "gzip" {
+			return nil, fmt.Sprintf("message is compressed with unsupported encoding %q", encoding)
+		}
+
+		gr, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Sprintf("decompressing message: %v", err)
+		}
+		defer gr.Close()
+
+		if payload, err = io.ReadAll(gr); err != nil {
+			return nil, fmt.Sprintf("decompressing message: %v", err)
+		}
+	}
+
+	msg := dynamicpb.NewMessage(msgType)
+	if err := (proto.UnmarshalOptions{Resolver: types}).Unmarshal(payload, msg); err != nil {
+		return nil, fmt.Sprintf("decoding %s: %v", msgType.FullName(), err)
+	}
+
+	res, err := (protojson.MarshalOptions{Resolver: types}).Marshal(msg)
+	if err != nil {
+		return nil, fmt.Sprintf("encoding %s as JSON: %v", msgType.FullName(), err)
+	}
+
+	return res, ""
+}
+
+// descriptorCache holds the descriptor sets read from .protoset files.
+// A file is read again when its modification time changes, like the config file.
+type descriptorCache struct {
+	mu        sync.Mutex
+	protosets map[string]*protoset
+}
+
+type protoset struct {
+	modTime time.Time
+	files   *protoregistry.Files
+	types   *dynamicpb.Types
+}
+
+func newDescriptorCache() *descriptorCache {
+	return &descriptorCache{protosets: map[string]*protoset{}}
+}
+
+// findMethod returns the method for a gRPC request path like /package.Service/Method
+// from the first descriptor set that defines it, along with the types of that set.
+func (dc *descriptorCache) findMethod(paths []string, methodPath string) (protoreflect.MethodDescriptor, *dynamicpb.Types, error) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(methodPath, "/"), "/")
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid gRPC method path %q", methodPath)
+	}
+
+	for _, path := range paths {
+		ps, err := dc.load(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		desc, err := ps.files.FindDescriptorByName(protoreflect.FullName(service))
+		if err != nil {
+			continue
+		}
+
+		if sd, ok := desc.(protoreflect.ServiceDescriptor); ok {
+			if md := sd.Methods().ByName(protoreflect.Name(method)); md != nil {
+				return md, ps.types, nil
+			}
+		}
+	}
+
+	return nil, nil, fmt.Errorf("method %s/%s not found in protosets", service, method)
+}
+
+func (dc *descriptorCache) load(path string) (*protoset, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading protoset: %w", err)
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	if ps, ok := dc.protosets[path]; ok && ps.modTime.Equal(info.ModTime()) {
+		return ps, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading protoset: %w", err)
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parsing protoset %s: %w", path, err)
+	}
+
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("parsing protoset %s: %w", path, err)
+	}
+
+	ps := &protoset{modTime: info.ModTime(), files: files, types: dynamicpb.NewTypes(files)}
+	dc.protosets[path] = ps
+
+	return ps, nil
+}
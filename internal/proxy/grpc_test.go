@@ -0,0 +1,152 @@
+package proxy_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/mishankov/proxymini/internal/proxy"
+	"github.com/mishankov/proxymini/internal/requestlog"
+)
+
+func TestProxyGRPC_KeepsTrailersAndDecodesMessages(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.URL.Path != "/test.Echo/Say" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		io.Copy(io.Discard, r.Body)
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.Write(grpcFrame(echoMessage("hi back")))
+		w.Header().Set("Grpc-Status", "3")
+		w.Header().Set("Grpc-Message", "bad%20argument")
+	}))
+	upstream.Config.Protocols = h2cProtocols()
+	upstream.Start()
+	defer upstream.Close()
+
+	protosetPath := writeEchoProtoset(t)
+
+	configContent := `[[proxy]]
+prefix = "/"
+target = "` + upstream.URL + `"
+protocol = "grpc"
+protosets = ["` + protosetPath + `"]`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	rlSvc := requestlog.NewRequestLogService(testDB)
+	proxyServer := httptest.NewUnstartedServer(proxy.NewProxyHandler(rlSvc, conf))
+	proxyServer.Config.Protocols = h2cProtocols()
+	proxyServer.Start()
+	defer proxyServer.Close()
+
+	transport := &http.Transport{Protocols: new(http.Protocols)}
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: transport}
+
+	req, _ := http.NewRequest(http.MethodPost, proxyServer.URL+"/test.Echo/Say", bytes.NewReader(grpcFrame(echoMessage("hi"))))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("failed to make request: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if status := resp.Trailer.Get("Grpc-Status"); status != "3" {
+		t.Errorf("expected grpc-status trailer '3', got '%s'", status)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	logs, err := rlSvc.GetList()
+	if err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 log, got %d", len(logs))
+	}
+
+	log := logs[0]
+	if log.GRPCStatus != "3" || log.GRPCMessage != "bad argument" {
+		t.Errorf("expected gRPC status 3 'bad argument', got %s '%s'", log.GRPCStatus, log.GRPCMessage)
+	}
+	if !strings.Contains(log.RequestMessages, `"text":"hi"`) {
+		t.Errorf("expected decoded request message, got %s", log.RequestMessages)
+	}
+	if !strings.Contains(log.ResponseMessages, `"text":"hi back"`) {
+		t.Errorf("expected decoded response message, got %s", log.ResponseMessages)
+	}
+}
+
+// writeEchoProtoset writes a descriptor set with the service test.Echo, whose method Say
+// takes and returns a test.EchoMessage with a single string field text.
+func writeEchoProtoset(t *testing.T) string {
+	t.Helper()
+
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("echo.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("EchoMessage"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("text"),
+				JsonName: proto.String("text"),
+				Number:   proto.Int32(1),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			}},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Echo"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("Say"),
+				InputType:  proto.String(".test.EchoMessage"),
+				OutputType: proto.String(".test.EchoMessage"),
+			}},
+		}},
+	}}}
+
+	data, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatalf("failed to marshal protoset: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "echo.protoset")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("failed to write protoset: %v", err)
+	}
+
+	return path
+}
+
+// echoMessage encodes a test.EchoMessage: field 1 with wire type 2, the length and the text.
+func echoMessage(text string) []byte {
+	return append([]byte{0x0a, byte(len(text))}, text...)
+}
+
+// grpcFrame prefixes an uncompressed message with its length.
+func grpcFrame(message []byte) []byte {
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	return append(frame, message...)
+}
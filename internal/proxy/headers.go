@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/mishankov/proxymini/internal/config"
+)
+
+// templatePattern matches placeholders in header rule values: {clientIP}, {host}, {prefix} and {env.NAME}.
+var templatePattern = regexp.MustCompile(`\{(clientIP|host|prefix|env\.[A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandTemplate replaces the placeholders in a header rule value with values of the request.
+func expandTemplate(value string, req *http.Request, route *route, clientIP string) string {
+	return templatePattern.ReplaceAllStringFunc(value, func(placeholder string) string {
+		switch name := placeholder[1 : len(placeholder)-1]; name {
+		case "clientIP":
+			return clientIP
+		case "host":
+			return req.Host
+		case "prefix":
+			return route.matchedPrefix(req)
+		default:
+			return os.Getenv(strings.TrimPrefix(name, "env."))
+		}
+	})
+}
+
+// applyHeaderRules modifies h according to rules: headers are removed first, then set, then added.
+func applyHeaderRules(h http.Header, rules config.HeaderRules, expand func(string) string) {
+	for _, name := range rules.Remove {
+		h.Del(name)
+	}
+
+	for name, value := range rules.Set {
+		h.Set(name, expand(value))
+	}
+
+	for name, value := range rules.Add {
+		h.Add(name, expand(value))
+	}
+}
+
+// remoteIP returns the IP address of the connection the request came from, which may be a proxy, see forwarding.clientIP.
+func remoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+
+	return host
+}
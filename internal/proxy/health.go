@@ -0,0 +1,289 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mishankov/proxymini/internal/config"
+	"github.com/platforma-dev/platforma/log"
+)
+
+// HealthCheckTick is how often CheckHealth is run. Shorter health check intervals are raised to it.
+const HealthCheckTick = 5 * time.Second
+
+const (
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckTimeout  = 5 * time.Second
+	defaultCircuitCooldown     = 30 * time.Second
+)
+
+// Health states of an upstream as reported by the admin API.
+const (
+	healthUnknown   = "unknown"
+	healthHealthy   = "healthy"
+	healthUnhealthy = "unhealthy"
+	healthEjected   = "ejected"
+)
+
+// healthCheckInterval returns the time between health checks of a route.
+// Intervals shorter than HealthCheckTick can't be honoured, so they are raised to it.
+func healthCheckInterval(healthCheck config.HealthCheck) time.Duration {
+	switch {
+	case healthCheck.Interval <= 0:
+		return defaultHealthCheckInterval
+	case healthCheck.Interval < HealthCheckTick:
+		return HealthCheckTick
+	}
+
+	return healthCheck.Interval
+}
+
+// upstreamState is the runtime state of a single target of a route. It is shared between config reloads.
+type upstreamState struct {
+	inFlight atomic.Int64
+
+	mu                  sync.Mutex
+	checking            bool
+	checked             bool
+	healthy             bool
+	lastCheckedAt       time.Time
+	lastStatus          int
+	lastError           string
+	consecutiveFailures int
+	ejectedUntil        time.Time
+}
+
+// available reports whether requests can be sent to the upstream: it did not fail its last
+// health check and it is not ejected by the circuit breaker.
+// The last health check is ignored when the route is no longer health checked, so its result can't stick after a reload.
+func (s *upstreamState) available(now time.Time, healthChecked bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if healthChecked && s.checked && !s.healthy {
+		return false
+	}
+
+	return !now.Before(s.ejectedUntil)
+}
+
+// recordResult feeds the outcome of a proxied request into the circuit breaker.
+// Failures are not reset when the cooldown ends, so one more failure ejects the upstream again.
+func (s *upstreamState) recordResult(failed bool, breaker config.CircuitBreaker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !failed {
+		s.consecutiveFailures = 0
+		return
+	}
+
+	s.consecutiveFailures++
+	if breaker.FailureThreshold > 0 && s.consecutiveFailures >= breaker.FailureThreshold {
+		cooldown := breaker.Cooldown
+		if cooldown <= 0 {
+			cooldown = defaultCircuitCooldown
+		}
+		s.ejectedUntil = time.Now().Add(cooldown)
+	}
+}
+
+// startCheck reports whether a health check is due and marks it as running.
+func (s *upstreamState) startCheck(now time.Time, interval time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.checking || now.Sub(s.lastCheckedAt) < interval {
+		return false
+	}
+
+	s.checking = true
+	return true
+}
+
+func (s *upstreamState) finishCheck(status int, err error, expectedStatus int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checking = false
+	s.checked = true
+	s.lastCheckedAt = time.Now()
+	s.lastStatus = status
+	s.lastError = ""
+
+	switch {
+	case err != nil:
+		s.healthy = false
+		s.lastError = err.Error()
+	case status != expectedStatus:
+		s.healthy = false
+		s.lastError = fmt.Sprintf("expected status %d, got %d", expectedStatus, status)
+	default:
+		s.healthy = true
+	}
+}
+
+// UpstreamHealth is the health state of a target as exposed by the admin API.
+type UpstreamHealth struct {
+	Route               string `json:"route"`
+	URL                 string `json:"url"`
+	State               string `json:"state"`
+	InFlight            int64  `json:"inFlight"`
+	ConsecutiveFailures int    `json:"consecutiveFailures"`
+	EjectedUntil        int64  `json:"ejectedUntil,omitempty"`
+	LastCheckedAt       int64  `json:"lastCheckedAt,omitempty"`
+	LastStatus          int    `json:"lastStatus,omitempty"`
+	LastError           string `json:"lastError,omitempty"`
+}
+
+func (s *upstreamState) health(route, url string, healthChecked bool, now time.Time) UpstreamHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := UpstreamHealth{
+		Route:               route,
+		URL:                 url,
+		State:               healthUnknown,
+		InFlight:            s.inFlight.Load(),
+		ConsecutiveFailures: s.consecutiveFailures,
+	}
+
+	if healthChecked && s.checked {
+		res.LastCheckedAt = s.lastCheckedAt.UTC().Unix()
+		res.LastStatus = s.lastStatus
+		res.LastError = s.lastError
+		res.State = healthHealthy
+		if !s.healthy {
+			res.State = healthUnhealthy
+		}
+	}
+
+	if now.Before(s.ejectedUntil) {
+		res.State = healthEjected
+		res.EjectedUntil = s.ejectedUntil.UTC().Unix()
+	}
+
+	return res
+}
+
+// CheckHealth runs the active health checks that are due for the targets of all routes with a health check.
+func (ph *ProxyHandler) CheckHealth(ctx context.Context) error {
+	router, err := ph.loadRouter()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var wg sync.WaitGroup
+	for _, route := range router.routes {
+		if route.HealthCheck.Path == "" {
+			continue
+		}
+
+		interval := healthCheckInterval(route.HealthCheck)
+		for _, u := range ph.upstreams.upstreams(route) {
+			if !u.state.startCheck(now, interval) {
+				continue
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ph.checkUpstream(ctx, route, u)
+			}()
+		}
+	}
+	wg.Wait()
+
+	return nil
+}
+
+func (ph *ProxyHandler) checkUpstream(ctx context.Context, route *route, u upstream) {
+	timeout := route.HealthCheck.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	expectedStatus := route.HealthCheck.ExpectedStatus
+	if expectedStatus == 0 {
+		expectedStatus = http.StatusOK
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var status int
+	key := transportKeyFor(route)
+	checkURL := resolveUnixTarget(joinURLPath(withUnixPathSeparator(u.url), route.HealthCheck.Path), &key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checkURL, nil)
+	if err == nil {
+		var client *http.Client
+		var resp *http.Response
+		client, err = ph.clientForKey(key)
+		if err == nil {
+			resp, err = client.Do(req)
+		}
+		if err == nil {
+			status = resp.StatusCode
+			resp.Body.Close()
+		}
+	}
+
+	u.state.finishCheck(status, err, expectedStatus)
+	if err != nil || status != expectedStatus {
+		log.WarnContext(ctx, "upstream health check failed", "upstream", u.url, "status", status, "error", err)
+	}
+}
+
+// Health returns the health state of the targets of all routes, one entry per route and target.
+func (ph *ProxyHandler) Health() ([]UpstreamHealth, error) {
+	router, err := ph.loadRouter()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	res := []UpstreamHealth{}
+	for _, route := range router.routes {
+		name := fmt.Sprintf("proxy #%d (%s)", route.index+1, route.pathPattern())
+		for _, u := range ph.upstreams.upstreams(route) {
+			res = append(res, u.state.health(name, u.url, route.HealthCheck.Path != "", now))
+		}
+	}
+
+	return res, nil
+}
+
+type HealthHandler struct {
+	proxyHandler *ProxyHandler
+}
+
+func NewHealthHandler(proxyHandler *ProxyHandler) *HealthHandler {
+	return &HealthHandler{proxyHandler: proxyHandler}
+}
+
+func (hh *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	res, err := hh.proxyHandler.Health()
+	if err != nil {
+		handleError(w, fmt.Errorf("getting upstream health: %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		handleError(w, fmt.Errorf("getting upstream health: %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(data)
+}
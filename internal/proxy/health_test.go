@@ -0,0 +1,441 @@
+package proxy_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mishankov/proxymini/internal/proxy"
+)
+
+func TestHealthCheck_UnhealthyTargetIsSkipped(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	healthyUpstream := newMockServer("healthy", http.StatusOK)
+	defer healthyUpstream.Close()
+
+	unhealthyUpstream := newMockServer("unhealthy", http.StatusServiceUnavailable)
+	defer unhealthyUpstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+targets = [{ url = "` + healthyUpstream.URL + `" }, { url = "` + unhealthyUpstream.URL + `" }]
+
+[proxy.healthCheck]
+path = "/health"
+interval = "1m"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	if err := handler.CheckHealth(context.Background()); err != nil {
+		t.Fatalf("failed to check health: %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		body, _ := io.ReadAll(rr.Body)
+		if string(body) != "healthy" {
+			t.Errorf("expected only healthy upstream to be used, got '%s'", string(body))
+		}
+	}
+}
+
+func TestHealthCheck_StateIgnoredWhenCheckRemoved(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"
+
+[proxy.healthCheck]
+path = "/health"
+interval = "1m"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	if err := handler.CheckHealth(context.Background()); err != nil {
+		t.Fatalf("failed to check health: %v", err)
+	}
+
+	serve := func() int {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/test", nil))
+		return rr.Code
+	}
+
+	if code := serve(); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected the unhealthy target to be skipped, got status %d", code)
+	}
+
+	// Removing the health check keeps the route, so its state is not pruned, but the last check no longer counts.
+	if err := os.WriteFile(conf.ConfigPath, []byte(`[[proxy]]
+prefix = "/api"
+target = "`+upstream.URL+`"`), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	if code := serve(); code != http.StatusOK {
+		t.Errorf("expected the target to get traffic after its health check was removed, got status %d", code)
+	}
+}
+
+func TestCircuitBreaker_EjectsFailingTarget(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	upstream := newMockServer("bad gateway", http.StatusBadGateway)
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"
+
+[proxy.circuitBreaker]
+failureThreshold = 2
+cooldown = "1m"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	expectedCodes := []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusServiceUnavailable}
+	for i, expectedCode := range expectedCodes {
+		req := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != expectedCode {
+			t.Errorf("request %d: expected status %d, got %d", i+1, expectedCode, rr.Code)
+		}
+	}
+}
+
+func TestCircuitBreaker_StateDroppedWhenRouteRemoved(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	upstream := newMockServer("bad gateway", http.StatusBadGateway)
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"
+
+[proxy.circuitBreaker]
+failureThreshold = 1
+cooldown = "1m"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	serve := func() int {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/test", nil))
+		return rr.Code
+	}
+
+	serve()
+	if code := serve(); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected the target to be ejected, got status %d", code)
+	}
+
+	// Reloading a config without the route drops its state, so the route starts fresh when it comes back.
+	if err := os.WriteFile(conf.ConfigPath, []byte(`[[proxy]]
+prefix = "/other"
+target = "`+upstream.URL+`"`), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	serve()
+
+	if err := os.WriteFile(conf.ConfigPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if code := serve(); code != http.StatusBadGateway {
+		t.Errorf("expected the target of the re-added route to get traffic, got status %d", code)
+	}
+}
+
+func TestUpstreamState_InFlightIsPerRoute(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+	testDB.SetMaxOpenConns(1)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/a"
+target = "` + upstream.URL + `"
+
+[[proxy]]
+prefix = "/b"
+target = "` + upstream.URL + `"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a/slow", nil))
+	}()
+	<-started
+
+	states, err := handler.Health()
+	close(release)
+	<-done
+	if err != nil {
+		t.Fatalf("failed to get health: %v", err)
+	}
+
+	if len(states) != 2 {
+		t.Fatalf("expected a state per route, got %d", len(states))
+	}
+	for _, state := range states {
+		expected := int64(0)
+		if strings.Contains(state.Route, `"/a"`) {
+			expected = 1
+		}
+		if state.InFlight != expected {
+			t.Errorf("%s: expected %d in flight, got %d", state.Route, expected, state.InFlight)
+		}
+	}
+}
+
+func TestUpstreamState_SettingsArePerRoute(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/health":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case strings.HasPrefix(r.URL.Path, "/fail"):
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer upstream.Close()
+
+	// All routes share the target, which fails its health check.
+	configContent := `[[proxy]]
+prefix = "/checked"
+target = "` + upstream.URL + `"
+[proxy.healthCheck]
+path = "/health"
+interval = "1m"
+
+[[proxy]]
+prefix = "/unchecked"
+target = "` + upstream.URL + `"
+
+[[proxy]]
+prefix = "/strict"
+target = "` + upstream.URL + `"
+[proxy.circuitBreaker]
+failureThreshold = 1
+cooldown = "1m"
+
+[[proxy]]
+prefix = "/lenient"
+target = "` + upstream.URL + `"
+[proxy.circuitBreaker]
+failureThreshold = 3
+cooldown = "1m"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	if err := handler.CheckHealth(context.Background()); err != nil {
+		t.Fatalf("failed to check health: %v", err)
+	}
+
+	steps := []struct {
+		path         string
+		expectedCode int
+	}{
+		{"/checked/ok", http.StatusServiceUnavailable},
+		{"/unchecked/ok", http.StatusOK},
+		{"/strict/fail", http.StatusBadGateway},
+		{"/lenient/fail", http.StatusBadGateway},
+		{"/strict/ok", http.StatusServiceUnavailable},
+		{"/lenient/ok", http.StatusOK},
+		{"/unchecked/ok", http.StatusOK},
+	}
+
+	for _, step := range steps {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, step.path, nil))
+
+		if rr.Code != step.expectedCode {
+			t.Errorf("%s: expected status %d, got %d", step.path, step.expectedCode, rr.Code)
+		}
+	}
+}
+
+func TestHealthCheck_IntervalBelowTickClamped(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	checks := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			checks++
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"
+[proxy.healthCheck]
+path = "/health"
+interval = "1s"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/test", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d for an interval below the scheduler tick, got %d", http.StatusOK, rr.Code)
+	}
+
+	if err := handler.CheckHealth(context.Background()); err != nil {
+		t.Fatalf("failed to check health: %v", err)
+	}
+
+	// The interval is raised to the tick, so the check is not due again after the configured second.
+	time.Sleep(1100 * time.Millisecond)
+	if err := handler.CheckHealth(context.Background()); err != nil {
+		t.Fatalf("failed to check health: %v", err)
+	}
+
+	if checks != 1 {
+		t.Errorf("expected 1 health check within the scheduler tick, got %d", checks)
+	}
+}
+
+func TestProxy_UnreachableTargetReturnsBadGateway(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	upstream := newMockServer("unused", http.StatusOK)
+	upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("expected status %d, got %d", http.StatusBadGateway, rr.Code)
+	}
+}
+
+func TestHealthHandler_ReturnsTargetStates(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	upstream := newMockServer("ok", http.StatusOK)
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"
+
+[proxy.healthCheck]
+path = "/health"
+
+[[proxy]]
+prefix = "/other"
+target = "http://localhost:9999"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	if err := handler.CheckHealth(context.Background()); err != nil {
+		t.Fatalf("failed to check health: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/upstreams", nil)
+	rr := httptest.NewRecorder()
+
+	proxy.NewHealthHandler(handler).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var states []proxy.UpstreamHealth
+	if err := json.Unmarshal(rr.Body.Bytes(), &states); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	byURL := map[string]proxy.UpstreamHealth{}
+	for _, state := range states {
+		byURL[state.URL] = state
+	}
+
+	if byURL[upstream.URL].State != "healthy" {
+		t.Errorf("expected checked target to be healthy, got '%s'", byURL[upstream.URL].State)
+	}
+	if byURL["http://localhost:9999"].State != "unknown" {
+		t.Errorf("expected unchecked target to be unknown, got '%s'", byURL["http://localhost:9999"].State)
+	}
+}
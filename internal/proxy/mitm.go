@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mishankov/proxymini/internal/certs"
+	"github.com/mishankov/proxymini/internal/requestlog"
+)
+
+// tlsRecordHandshake is the first byte of a TLS connection, the content type of the ClientHello record.
+const tlsRecordHandshake = 0x16
+
+// EnableMITM makes the forward proxy decrypt CONNECT tunnels with certificates issued by the CA.
+// It must be called before the handler serves requests.
+func (ph *ProxyHandler) EnableMITM(ca *certs.CA) {
+	ph.ca = ca
+}
+
+// intercept terminates TLS of an accepted CONNECT tunnel with a certificate for the target issued by the CA,
+// and proxies the requests inside it to the target like forward proxy requests, so each of them is logged.
+// Tunnels that don't start with a TLS handshake are relayed unchanged.
+func (ph *ProxyHandler) intercept(r *http.Request, route *route, reqLog requestlog.RequestLog, startedAt time.Time, clientConn net.Conn) {
+	br := bufio.NewReader(clientConn)
+	first, err := br.Peek(1)
+	if err != nil {
+		return
+	}
+	clientConn = &bufferedConn{Conn: clientConn, r: br}
+
+	if first[0] != tlsRecordHandshake {
+		targetConn, err := ph.dialTunnel(r, route, reqLog, startedAt)
+		if err != nil {
+			return
+		}
+		defer targetConn.Close()
+
+		ph.relayTunnel(r, route, reqLog, startedAt, clientConn, targetConn)
+		return
+	}
+
+	host, port, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host, port = r.Host, "443"
+	}
+
+	listener := newConnListener(clientConn.LocalAddr())
+	tlsConn := tls.Server(&closeNotifyConn{Conn: clientConn, onClose: listener.Close}, &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName != "" {
+				return ph.ca.Certificate(hello.ServerName)
+			}
+			return ph.ca.Certificate(host)
+		},
+		NextProtos: []string{"h2", "http/1.1"},
+	})
+	// A client that doesn't trust the CA fails the handshake, which is logged to make the cause visible.
+	if err := tlsConn.HandshakeContext(r.Context()); err != nil {
+		reqLog.Status = 0
+		reqLog.Error = fmt.Sprintf("TLS handshake with client: %v", err)
+		reqLog.ElapsedMS = time.Since(startedAt).Milliseconds()
+		ph.saveLog(r, route, reqLog)
+		return
+	}
+
+	origin := "https://" + host
+	if port != "443" {
+		origin = "https://" + net.JoinHostPort(host, port)
+	}
+
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ph.serveIntercepted(w, r, origin)
+		}),
+		Protocols: protocols,
+	}
+
+	listener.conns <- tlsConn
+	server.Serve(listener)
+}
+
+// serveIntercepted proxies a request from a decrypted tunnel to the origin of the tunnel.
+func (ph *ProxyHandler) serveIntercepted(w http.ResponseWriter, r *http.Request, origin string) {
+	w.Header().Set("X-Proxy-Mini", "true")
+
+	route := ph.forwardRoute(origin)
+	body, err := newRequestBody(r, false, ph.captureLimit(route))
+	if err != nil {
+		handleError(w, fmt.Errorf("error reading request body: %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	ph.forward(w, r, route, body, 1, retryPolicy{})
+}
+
+// connListener is a net.Listener that accepts the connections sent to conns until it is closed.
+// It lets an http.Server serve a single connection that was accepted elsewhere.
+type connListener struct {
+	conns chan net.Conn
+	addr  net.Addr
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newConnListener(addr net.Addr) *connListener {
+	return &connListener{conns: make(chan net.Conn, 1), addr: addr, done: make(chan struct{})}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *connListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.addr
+}
+
+// closeNotifyConn calls onClose when the connection is closed, whether by the server or by a handler that hijacked it.
+type closeNotifyConn struct {
+	net.Conn
+	onClose func() error
+}
+
+func (c *closeNotifyConn) Close() error {
+	defer c.onClose()
+	return c.Conn.Close()
+}
+
+// CAHandler serves the certificate of the MITM CA, so it can be installed in trust stores.
+type CAHandler struct {
+	ca *certs.CA
+}
+
+func NewCAHandler(ca *certs.CA) *CAHandler {
+	return &CAHandler{ca: ca}
+}
+
+func (ch *CAHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+	w.Header().Set("Content-Disposition", `attachment; filename="proxymini-ca.crt"`)
+	w.Write(ch.ca.CertPEM())
+}
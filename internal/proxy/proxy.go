@@ -1,17 +1,17 @@
 package proxy
 
 import (
-	"bytes"
 	"context"
-	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/mishankov/proxymini/internal/certs"
 	"github.com/mishankov/proxymini/internal/config"
 	"github.com/mishankov/proxymini/internal/requestlog"
 	"github.com/mishankov/proxymini/internal/utils"
@@ -19,71 +19,124 @@ import (
 )
 
 type ProxyHandler struct {
-	rlSvc          *requestlog.RequestLogService
-	config         *config.Config
-	insecureClient *http.Client
+	mu        sync.Mutex
+	rlSvc     *requestlog.RequestLogService
+	config    *config.Config
+	upstreams *upstreamPool
+
+	clientsMu sync.Mutex
+	clients   map[transportKey]*http.Client
+
+	descriptors *descriptorCache
+	forwarding  *forwarding
+	// ca issues certificates for decrypted CONNECT tunnels, see EnableMITM. Tunnels are relayed unchanged without it.
+	ca *certs.CA
 }
 
 func NewProxyHandler(rlSvc *requestlog.RequestLogService, config *config.Config) *ProxyHandler {
-	insecureClient := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
+	router, err := newRouter(config.Proxies)
+	if err != nil {
+		log.Warn("invalid proxy config", "error", err)
+	} else {
+		for _, warning := range router.shadowed() {
+			log.Warn("proxy route is never used", "reason", warning)
+		}
+		for _, route := range router.routes {
+			if route.HealthCheck.Path != "" && route.HealthCheck.Interval > 0 && route.HealthCheck.Interval < HealthCheckTick {
+				log.Warn("health check interval is shorter than the scheduler tick, using the tick",
+					"proxy", route.index+1, "interval", route.HealthCheck.Interval, "tick", HealthCheckTick)
+			}
+		}
+	}
+
+	fwd, err := newForwarding(config.Forwarding)
+	if err != nil {
+		log.Warn("invalid forwarding config, no proxies are trusted", "error", err)
+		fwd = &forwarding{Forwarding: config.Forwarding}
 	}
 
 	return &ProxyHandler{
-		rlSvc:          rlSvc,
-		config:         config,
-		insecureClient: insecureClient,
+		rlSvc:     rlSvc,
+		config:    config,
+		upstreams: newUpstreamPool(),
+		clients:   map[transportKey]*http.Client{},
+
+		descriptors: newDescriptorCache(),
+		forwarding:  fwd,
 	}
 }
 
 func (ph *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("X-Proxy-Mini", "true")
-	startedAt := time.Now()
 
-	err := ph.config.ReloadProxies()
+	router, err := ph.loadRouter()
 	if err != nil {
-		handleError(w, fmt.Errorf("error getting config: %w", err), http.StatusInternalServerError)
+		handleError(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	target := ""
-	prefix := ""
-	skipLogging := false
-	insecureTLSSkipVerify := false
-	for _, proxy := range ph.config.Proxies {
-		if strings.HasPrefix(r.URL.Path, proxy.Prefix) {
-			target = proxy.Target
-			prefix = proxy.Prefix
-			skipLogging = proxy.SkipLogging
-			insecureTLSSkipVerify = proxy.InsecureTLSSkipVerify
-		}
-	}
-
-	if target == "" {
+	route := router.match(r)
+	if route == nil {
 		handleError(w, fmt.Errorf("no matching proxy found for URL: %s", fullURL(r)), http.StatusNotFound)
 		return
 	}
 
-	reqBody, err := io.ReadAll(r.Body)
+	retry := newRetryPolicy(route.Retry, r.Method)
+	body, err := newRequestBody(r, retry.enabled, ph.captureLimit(route))
 	if err != nil {
 		handleError(w, fmt.Errorf("error reading request body: %w", err), http.StatusInternalServerError)
 		return
 	}
+	// A body that was already streamed to an upstream can't be sent again.
+	retry.enabled = retry.enabled && body.replayable
 
-	targetUrl := target + strings.TrimPrefix(r.URL.Path, prefix)
-	if r.URL.RawQuery != "" {
-		targetUrl += "?" + r.URL.RawQuery
+	for attempt := 1; ; attempt++ {
+		done := ph.forward(w, r, route, body, attempt, retry)
+		if done {
+			return
+		}
+
+		if !sleep(r.Context(), retry.backoff(attempt)) {
+			handleError(w, fmt.Errorf("request canceled while waiting for retry: %w", r.Context().Err()), http.StatusBadGateway)
+			return
+		}
 	}
-	if r.URL.Fragment != "" {
-		targetUrl += "#" + r.URL.Fragment
+}
+
+// forward makes one attempt to proxy the request to an upstream of the route.
+// It returns false if the attempt failed and should be retried. In that case nothing is written to w.
+func (ph *ProxyHandler) forward(w http.ResponseWriter, r *http.Request, route *route, body *requestBody, attempt int, retry retryPolicy) bool {
+	startedAt := time.Now()
+
+	upstream, ok := ph.pickUpstream(route, r)
+	if !ok {
+		handleError(w, fmt.Errorf("no healthy upstream available for URL: %s", fullURL(r)), http.StatusServiceUnavailable)
+		return true
+	}
+	upstream.state.inFlight.Add(1)
+	defer upstream.state.inFlight.Add(-1)
+
+	targetUrl := route.targetURL(r, withUnixPathSeparator(webSocketTargetToHTTP(upstream.url)))
+
+	key := transportKeyFor(route)
+	// Switching protocols is only possible over HTTP/1.1.
+	if isWebSocketUpgrade(r) {
+		key.protocol = protocolHTTP1
+	}
+	requestURL := resolveUnixTarget(targetUrl, &key)
+
+	ctx := r.Context()
+	// The total timeout limits the WebSocket handshake, not the lifetime of the connection.
+	if route.TotalTimeout > 0 && !isWebSocketUpgrade(r) {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, route.TotalTimeout)
+		defer cancel()
 	}
 
-	req, err := http.NewRequest(r.Method, targetUrl, bytes.NewReader(reqBody))
+	req, err := body.newUpstreamRequest(ctx, r.Method, requestURL)
 	if err != nil {
 		handleError(w, fmt.Errorf("error creating request: %w", err), http.StatusInternalServerError)
-		return
+		return true
 	}
 
 	for hn, hvs := range r.Header {
@@ -92,52 +145,209 @@ func (ph *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	client := http.DefaultClient
-	if insecureTLSSkipVerify {
-		client = ph.insecureClient
+	removeHopByHopHeaders(req.Header)
+	// Upgrades and "TE: trailers", which gRPC requires, are passed on explicitly.
+	if isWebSocketUpgrade(r) {
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", r.Header.Get("Upgrade"))
+	}
+	if headerHasToken(r.Header, "Te", "trailers") {
+		req.Header.Set("Te", "trailers")
+	}
+	ph.forwarding.apply(req.Header, r)
+
+	clientIP := ph.forwarding.clientIP(r)
+	expand := func(value string) string { return expandTemplate(value, r, route, clientIP) }
+	applyHeaderRules(req.Header, route.RequestHeaders, expand)
+	// The Host header is not sent from req.Header, so a Host rule overrides req.Host instead.
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+		req.Header.Del("Host")
+	}
+
+	client, err := ph.clientForKey(key)
+	if err != nil {
+		handleError(w, fmt.Errorf("error creating upstream client: %w", err), http.StatusBadGateway)
+		return true
 	}
 
 	resp, err := client.Do(req)
+	upstream.state.recordResult(err != nil || isUpstreamFailure(resp.StatusCode), route.CircuitBreaker)
+
+	newLog := func(status int, responseHeaders http.Header, respCapture *responseCapture, err error) requestlog.RequestLog {
+		respBody, decoded := &utils.LimitedBuffer{}, false
+		if respCapture != nil {
+			respBody, decoded = respCapture.body()
+		}
+
+		reqLog := requestlog.New(
+			r.Method,
+			fullURL(r),
+			targetUrl,
+			r.Header,
+			string(body.capture.Bytes()),
+			status,
+			responseHeaders,
+			string(respBody.Bytes()),
+			time.Since(startedAt).Milliseconds(),
+		)
+		reqLog.RequestBodySize = body.capture.Size()
+		reqLog.RequestBodyTruncated = body.capture.Truncated()
+		reqLog.ResponseBodySize = respBody.Size()
+		reqLog.ResponseBodyTruncated = respBody.Truncated()
+		if decoded {
+			reqLog.ResponseBodyDecoded = true
+			reqLog.ResponseBodyEncodedSize = respCapture.encoded.Size()
+		}
+		reqLog.Upstream = upstream.url
+		reqLog.Protocol = r.Proto
+		if resp != nil {
+			reqLog.UpstreamProtocol = resp.Proto
+		}
+		if route.Protocol == protocolGRPC {
+			ph.logGRPC(&reqLog, route, req.URL.Path, r.Header, resp, body.capture.Bytes(), respBody.Bytes())
+		}
+		reqLog.UpstreamProxy = redactedUpstreamProxy(route.UpstreamProxy)
+		reqLog.Attempt = attempt
+		if err != nil {
+			reqLog.Error = err.Error()
+			reqLog.TimedOut = isTimeout(err)
+			reqLog.UpstreamProxyFailed = isUpstreamProxyError(err)
+		}
+
+		return reqLog
+	}
+	logAttempt := func(status int, responseHeaders http.Header, respCapture *responseCapture, err error) {
+		ph.saveLog(r, route, newLog(status, responseHeaders, respCapture, err))
+	}
+
+	if retry.shouldRetry(attempt, resp, err) {
+		if err != nil {
+			logAttempt(0, http.Header{}, nil, err)
+			return false
+		}
+
+		respCapture := newResponseCapture(resp.Header, ph.captureLimit(route))
+		io.Copy(respCapture, resp.Body)
+		resp.Body.Close()
+		respCapture.close()
+		logAttempt(resp.StatusCode, resp.Header, respCapture, fmt.Errorf("upstream responded with retryable status %d", resp.StatusCode))
+		return false
+	}
+
 	if err != nil {
-		handleError(w, fmt.Errorf("error making request: %w", err), http.StatusInternalServerError)
-		return
+		logAttempt(0, http.Header{}, nil, err)
+		if isTimeout(err) {
+			handleError(w, fmt.Errorf("upstream timed out: %w", err), http.StatusGatewayTimeout)
+		} else if isUpstreamProxyError(err) {
+			handleError(w, fmt.Errorf("error connecting through upstream proxy: %w", err), http.StatusBadGateway)
+		} else {
+			handleError(w, fmt.Errorf("error making request: %w", err), http.StatusBadGateway)
+		}
+		return true
 	}
 	defer resp.Body.Close()
 
-	for hn, hvs := range resp.Header {
+	respHeader := resp.Header.Clone()
+	removeHopByHopHeaders(respHeader)
+	// The handshake of a switched connection is written as is, so it has to keep Upgrade.
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		respHeader.Set("Connection", "Upgrade")
+		respHeader.Set("Upgrade", resp.Header.Get("Upgrade"))
+	}
+	if ph.forwarding.Via {
+		respHeader.Add("Via", via(resp.ProtoMajor, resp.ProtoMinor))
+	}
+	for hn, hvs := range respHeader {
 		for _, hv := range hvs {
 			w.Header().Add(hn, hv)
 		}
 	}
+	applyHeaderRules(w.Header(), route.ResponseHeaders, expand)
+
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		ph.relayWebSocket(w, r, route, resp, newLog(resp.StatusCode, resp.Header, nil, nil), startedAt)
+		return true
+	}
+
+	respCapture := newResponseCapture(resp.Header, ph.captureLimit(route))
+
+	// Streaming responses are logged when they start, their events are recorded as they arrive,
+	// and the log is updated when the stream ends.
+	var capture io.Writer = respCapture
+	var streamLog *requestlog.RequestLog
+	var stream *streamRecorder
+	if isStreamingResponse(resp, route.StreamContentTypes, route.SkipChunkedStreams) && !route.SkipLogging {
+		reqLog := newLog(resp.StatusCode, resp.Header, nil, nil)
+		reqLog.Streaming = true
+		ph.saveLog(r, route, reqLog)
+
+		streamLog = &reqLog
+		stream = &streamRecorder{rlSvc: ph.rlSvc, requestLogID: reqLog.ID, sse: isEventStream(resp)}
+		capture = io.MultiWriter(respCapture, stream)
+	}
 
 	w.WriteHeader(resp.StatusCode)
 
-	body, err := utils.CopyBuffer(w, resp.Body, []byte{})
+	err = utils.CopyBuffer(w, resp.Body, []byte{}, capture)
 	// Some clients cause `write: broken pipe` error in the end of a request. This seems to be ok, so ignore `syscall.EPIPE`.
-	if err != nil && !errors.Is(err, syscall.EPIPE) {
+	if errors.Is(err, syscall.EPIPE) {
+		err = nil
+	}
+	if err != nil {
 		handleError(w, fmt.Errorf("error copying buffer: %w", err), http.StatusInternalServerError)
 	}
+	// Trailers, such as the status of gRPC calls, are known once the body was read.
+	for name, values := range resp.Trailer {
+		w.Header()[http.TrailerPrefix+name] = values
+	}
+	respCapture.close()
 
-	elapsedMS := time.Since(startedAt).Milliseconds()
+	if streamLog == nil {
+		logAttempt(resp.StatusCode, resp.Header, respCapture, err)
+		return true
+	}
 
-	if !skipLogging {
-		reqLog := requestlog.New(
-			r.Method,
-			fullURL(r),
-			targetUrl,
-			r.Header,
-			string(reqBody),
-			resp.StatusCode,
-			resp.Header,
-			string(body),
-			elapsedMS,
-		)
+	stream.flush()
+	reqLog := newLog(resp.StatusCode, resp.Header, respCapture, err)
+	reqLog.ID, reqLog.Time, reqLog.Streaming = streamLog.ID, streamLog.Time, true
+	ph.saveLog(r, route, reqLog)
 
-		err = ph.rlSvc.Save(reqLog)
-		if err != nil {
-			log.ErrorContext(r.Context(), "failed to save request log", "error", err)
-		}
+	return true
+}
+
+// saveLog stores the request log unless logging is disabled for the route.
+func (ph *ProxyHandler) saveLog(r *http.Request, route *route, reqLog requestlog.RequestLog) {
+	if route.SkipLogging {
+		return
 	}
+
+	if err := ph.rlSvc.Save(reqLog); err != nil {
+		log.ErrorContext(r.Context(), "failed to save request log", "error", err)
+	}
+}
+
+// loadRouter reloads proxy routes from the config file.
+func (ph *ProxyHandler) loadRouter() (*router, error) {
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+
+	if err := ph.config.ReloadProxies(); err != nil {
+		return nil, fmt.Errorf("error getting config: %w", err)
+	}
+
+	router, err := newRouter(ph.config.Proxies)
+	if err != nil {
+		return nil, fmt.Errorf("error getting config: %w", err)
+	}
+	ph.upstreams.prune(router.routes)
+
+	return router, nil
+}
+
+// isUpstreamFailure reports whether a response status means the upstream itself is failing.
+func isUpstreamFailure(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
 }
 
 func handleError(w http.ResponseWriter, err error, status int) {
@@ -2,14 +2,19 @@ package proxy_test
 
 import (
 	"bytes"
+	"crypto/tls"
+	"encoding/pem"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/mishankov/proxymini/internal/certs"
 	"github.com/mishankov/proxymini/internal/config"
 	"github.com/mishankov/proxymini/internal/db"
 	"github.com/mishankov/proxymini/internal/proxy"
@@ -75,6 +80,726 @@ target = "http://localhost:9999"`
 	}
 }
 
+func TestProxyRouting_HostMatching(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	apiUpstream := newMockServer("api-response", http.StatusOK)
+	defer apiUpstream.Close()
+
+	authUpstream := newMockServer("auth-response", http.StatusOK)
+	defer authUpstream.Close()
+
+	configContent := `[[proxy]]
+host = "api.local"
+prefix = "/"
+target = "` + apiUpstream.URL + `/"
+
+[[proxy]]
+host = "auth.local"
+prefix = "/"
+target = "` + authUpstream.URL + `/"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	tests := []struct {
+		url          string
+		expectedCode int
+		expectedBody string
+	}{
+		{"http://api.local/users", http.StatusOK, "api-response"},
+		{"http://auth.local:14443/login", http.StatusOK, "auth-response"},
+		{"http://other.local/users", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tt.expectedCode {
+			t.Errorf("%s: expected status %d, got %d", tt.url, tt.expectedCode, rr.Code)
+		}
+
+		body, _ := io.ReadAll(rr.Body)
+		if tt.expectedBody != "" && string(body) != tt.expectedBody {
+			t.Errorf("%s: expected body '%s', got '%s'", tt.url, tt.expectedBody, string(body))
+		}
+	}
+}
+
+func TestProxyRouting_WildcardHost(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	upstream := newMockServer("dev-response", http.StatusOK)
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+host = "*.dev.local"
+prefix = "/"
+target = "` + upstream.URL + `/"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	req := httptest.NewRequest(http.MethodGet, "http://api.dev.local/users", nil)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://dev.local/users", nil)
+	rr = httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for bare domain, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestProxyRouting_LongestPrefixWins(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	generalUpstream := newMockServer("general-response", http.StatusOK)
+	defer generalUpstream.Close()
+
+	specificUpstream := newMockServer("specific-response", http.StatusOK)
+	defer specificUpstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api/users"
+target = "` + specificUpstream.URL + `"
+
+[[proxy]]
+prefix = "/api"
+target = "` + generalUpstream.URL + `"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	tests := []struct {
+		path         string
+		expectedBody string
+	}{
+		{"/api/users/1", "specific-response"},
+		{"/api/orders", "general-response"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		body, _ := io.ReadAll(rr.Body)
+		if string(body) != tt.expectedBody {
+			t.Errorf("%s: expected body '%s', got '%s'", tt.path, tt.expectedBody, string(body))
+		}
+	}
+}
+
+func TestProxyRouting_PrefixMatchesOnSegmentBoundary(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	upstream := newMockServer("upstream-response", http.StatusOK)
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	tests := []struct {
+		path         string
+		expectedCode int
+	}{
+		{"/api", http.StatusOK},
+		{"/api/", http.StatusOK},
+		{"/api/users", http.StatusOK},
+		{"/apiv2/users", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tt.expectedCode {
+			t.Errorf("%s: expected status %d, got %d", tt.path, tt.expectedCode, rr.Code)
+		}
+	}
+}
+
+func TestProxyRouting_PriorityBreaksTies(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	lowUpstream := newMockServer("low-response", http.StatusOK)
+	defer lowUpstream.Close()
+
+	highUpstream := newMockServer("high-response", http.StatusOK)
+	defer highUpstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + lowUpstream.URL + `"
+
+[[proxy]]
+prefix = "/api"
+target = "` + highUpstream.URL + `"
+priority = 10`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	body, _ := io.ReadAll(rr.Body)
+	if string(body) != "high-response" {
+		t.Errorf("expected body 'high-response', got '%s'", string(body))
+	}
+}
+
+func TestProxyRouting_PriorityDoesNotOverrideLongerPrefix(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	rootUpstream := newMockServer("root-response", http.StatusOK)
+	defer rootUpstream.Close()
+
+	apiUpstream := newMockServer("api-response", http.StatusOK)
+	defer apiUpstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/"
+target = "` + rootUpstream.URL + `"
+priority = 10
+
+[[proxy]]
+prefix = "/api"
+target = "` + apiUpstream.URL + `"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	tests := []struct {
+		path         string
+		expectedBody string
+	}{
+		{"/api/users", "api-response"},
+		{"/other", "root-response"},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if body := rr.Body.String(); body != tt.expectedBody {
+			t.Errorf("%s: expected body '%s', got '%s'", tt.path, tt.expectedBody, body)
+		}
+	}
+}
+
+func TestProxyRouting_RegexRoutesRankAbovePriority(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	regexUpstream := newMockServer("regex-response", http.StatusOK)
+	defer regexUpstream.Close()
+
+	prefixUpstream := newMockServer("prefix-response", http.StatusOK)
+	defer prefixUpstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/users"
+target = "` + prefixUpstream.URL + `"
+priority = 10
+
+[[proxy]]
+pathRegex = "^/users/(\\d+)"
+target = "` + regexUpstream.URL + `"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+	if body := rr.Body.String(); body != "regex-response" {
+		t.Errorf("expected the regex route to win over a prefix route with higher priority, got '%s'", body)
+	}
+}
+
+func TestProxyRouting_PathRegexRewritesTarget(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	var receivedURL string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedURL = r.URL.RequestURI()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/users"
+target = "http://localhost:9999"
+
+[[proxy]]
+pathRegex = "^/users/(\\d+)/orders"
+target = "` + upstream.URL + `/v2/customers/$1/orders"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	tests := []struct {
+		path        string
+		expectedURL string
+	}{
+		{"/users/42/orders", "/v2/customers/42/orders"},
+		{"/users/42/orders/7?expand=items", "/v2/customers/42/orders/7?expand=items"},
+	}
+
+	for _, tt := range tests {
+		receivedURL = ""
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: expected status %d, got %d", tt.path, http.StatusOK, rr.Code)
+		}
+		if receivedURL != tt.expectedURL {
+			t.Errorf("%s: expected URL '%s', got '%s'", tt.path, tt.expectedURL, receivedURL)
+		}
+	}
+}
+
+func TestProxyRouting_InvalidPathRegex(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	configContent := `[[proxy]]
+pathRegex = "^/users/(\\d+"
+target = "http://localhost:9999"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+}
+
+func TestProxyRouting_MatchConditions(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	defaultUpstream := newMockServer("default-response", http.StatusOK)
+	defer defaultUpstream.Close()
+
+	uploadUpstream := newMockServer("upload-response", http.StatusOK)
+	defer uploadUpstream.Close()
+
+	canaryUpstream := newMockServer("canary-response", http.StatusOK)
+	defer canaryUpstream.Close()
+
+	debugUpstream := newMockServer("debug-response", http.StatusOK)
+	defer debugUpstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + defaultUpstream.URL + `"
+
+[[proxy]]
+prefix = "/api"
+target = "` + uploadUpstream.URL + `"
+[proxy.match]
+methods = ["post"]
+
+[[proxy]]
+prefix = "/api"
+target = "` + canaryUpstream.URL + `"
+[proxy.match]
+headers = { "X-Canary" = "1" }
+
+[[proxy]]
+prefix = "/api"
+target = "` + debugUpstream.URL + `"
+[proxy.match]
+query = ["debug"]
+headerRegex = { "User-Agent" = "^curl/" }`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		headers      map[string]string
+		expectedBody string
+	}{
+		{"no conditions", http.MethodGet, "/api/upload", nil, "default-response"},
+		{"method", http.MethodPost, "/api/upload", nil, "upload-response"},
+		{"header", http.MethodGet, "/api/upload", map[string]string{"X-Canary": "1"}, "canary-response"},
+		{"header mismatch", http.MethodGet, "/api/upload", map[string]string{"X-Canary": "0"}, "default-response"},
+		{"query and header regex", http.MethodGet, "/api/upload?debug", map[string]string{"User-Agent": "curl/8.0"}, "debug-response"},
+		{"query without header regex", http.MethodGet, "/api/upload?debug", map[string]string{"User-Agent": "firefox"}, "default-response"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		for name, value := range tt.headers {
+			req.Header.Set(name, value)
+		}
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		body, _ := io.ReadAll(rr.Body)
+		if string(body) != tt.expectedBody {
+			t.Errorf("%s: expected body '%s', got '%s'", tt.name, tt.expectedBody, string(body))
+		}
+	}
+}
+
+func TestProxyRouting_MatchHeadersWithSeveralValues(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	defaultUpstream := newMockServer("default-response", http.StatusOK)
+	defer defaultUpstream.Close()
+
+	canaryUpstream := newMockServer("canary-response", http.StatusOK)
+	defer canaryUpstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + defaultUpstream.URL + `"
+
+[[proxy]]
+prefix = "/api"
+target = "` + canaryUpstream.URL + `"
+[proxy.match]
+headers = { "X-Canary" = "1" }
+headerRegex = { "X-Tags" = "^beta$" }`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	tests := []struct {
+		name         string
+		headers      http.Header
+		expectedBody string
+	}{
+		{"repeated headers", http.Header{"X-Canary": {"0", "1"}, "X-Tags": {"alpha", "beta"}}, "canary-response"},
+		{"comma-joined values", http.Header{"X-Canary": {"0, 1"}, "X-Tags": {"alpha,beta"}}, "canary-response"},
+		{"no matching value", http.Header{"X-Canary": {"0", "2"}, "X-Tags": {"beta"}}, "default-response"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/upload", nil)
+		req.Header = tt.headers
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if body := rr.Body.String(); body != tt.expectedBody {
+			t.Errorf("%s: expected body '%s', got '%s'", tt.name, tt.expectedBody, body)
+		}
+	}
+}
+
+func TestProxyLoadBalancing_RoundRobinWithWeights(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	firstUpstream := newMockServer("first", http.StatusOK)
+	defer firstUpstream.Close()
+
+	secondUpstream := newMockServer("second", http.StatusOK)
+	defer secondUpstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+strategy = "round-robin"
+
+[[proxy.targets]]
+url = "` + firstUpstream.URL + `"
+weight = 2
+
+[[proxy.targets]]
+url = "` + secondUpstream.URL + `"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	var bodies []string
+	for i := 0; i < 6; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		body, _ := io.ReadAll(rr.Body)
+		bodies = append(bodies, string(body))
+	}
+
+	expected := "first,first,second,first,first,second"
+	if strings.Join(bodies, ",") != expected {
+		t.Errorf("expected upstreams '%s', got '%s'", expected, strings.Join(bodies, ","))
+	}
+}
+
+func TestProxyLoadBalancing_HashIsSticky(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	var upstreamURLs []string
+	for _, name := range []string{"first", "second", "third"} {
+		upstream := newMockServer(name, http.StatusOK)
+		defer upstream.Close()
+		upstreamURLs = append(upstreamURLs, upstream.URL)
+	}
+
+	configContent := `[[proxy]]
+prefix = "/api"
+strategy = "hash"
+hashOn = "cookie:session"
+targets = [
+	{ url = "` + upstreamURLs[0] + `" },
+	{ url = "` + upstreamURLs[1] + `" },
+	{ url = "` + upstreamURLs[2] + `" },
+]`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	for _, session := range []string{"alice", "bob", "carol"} {
+		seen := map[string]bool{}
+		for i := 0; i < 5; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+			req.AddCookie(&http.Cookie{Name: "session", Value: session})
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			body, _ := io.ReadAll(rr.Body)
+			seen[string(body)] = true
+		}
+
+		if len(seen) != 1 {
+			t.Errorf("expected session '%s' to stick to one upstream, got %v", session, seen)
+		}
+	}
+}
+
+func TestProxyLoadBalancing_UnknownStrategy(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "http://localhost:9999"
+strategy = "fastest"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+}
+
+func TestProxyRetry_RetriesRetryableStatus(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("recovered"))
+	}))
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"
+
+[proxy.retry]
+maxAttempts = 3
+retryOnStatus = [503]
+backoff = "1ms"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 upstream calls, got %d", calls)
+	}
+
+	body, _ := io.ReadAll(rr.Body)
+	if string(body) != "recovered" {
+		t.Errorf("expected body 'recovered', got '%s'", string(body))
+	}
+}
+
+func TestProxyRetry_SkipsNonIdempotentMethods(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"
+
+[proxy.retry]
+maxAttempts = 3
+retryOnStatus = [503]
+backoff = "1ms"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/test", bytes.NewBufferString("payload"))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 upstream call, got %d", calls)
+	}
+}
+
+func TestProxyTimeouts_ReturnGatewayTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout string
+	}{
+		{name: "response header timeout", timeout: `responseHeaderTimeout = "50ms"`},
+		{name: "total timeout", timeout: `totalTimeout = "50ms"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB, cleanupDB := setupTestDB()
+			defer cleanupDB()
+
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(time.Second):
+				}
+			}))
+			defer upstream.Close()
+
+			configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"
+` + tt.timeout
+
+			conf, cleanupConfig := createTestConfig(configContent)
+			defer cleanupConfig()
+
+			handler := newTestProxyHandler(testDB, conf)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+			rr := httptest.NewRecorder()
+
+			startedAt := time.Now()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusGatewayTimeout {
+				t.Errorf("expected status %d, got %d", http.StatusGatewayTimeout, rr.Code)
+			}
+			if elapsed := time.Since(startedAt); elapsed > 500*time.Millisecond {
+				t.Errorf("expected request to time out quickly, took %v", elapsed)
+			}
+		})
+	}
+}
+
 func TestProxyRequestHeaders_Forwarded(t *testing.T) {
 	testDB, cleanupDB := setupTestDB()
 	defer cleanupDB()
@@ -97,16 +822,211 @@ target = "` + upstream.URL + `"`
 
 	req := httptest.NewRequest(http.MethodGet, "/api/test", nil)
 	req.Header.Set("X-Custom-Header", "custom-value")
-	req.Header.Set("Authorization", "Bearer token123")
+	req.Header.Set("Authorization", "Bearer token123")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if receivedHeaders.Get("X-Custom-Header") != "custom-value" {
+		t.Errorf("expected X-Custom-Header to be forwarded")
+	}
+	if receivedHeaders.Get("Authorization") != "Bearer token123" {
+		t.Errorf("expected Authorization header to be forwarded")
+	}
+}
+
+func TestProxyRequestHeaders_Rules(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	t.Setenv("PROXYMINI_TEST_TENANT", "acme")
+
+	var receivedHeaders http.Header
+	var receivedHost string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedHeaders = r.Header
+		receivedHost = r.Host
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"
+
+[proxy.requestHeaders]
+set = { Host = "internal.example.com", X-Client-IP = "{clientIP}", X-Tenant = "{env.PROXYMINI_TEST_TENANT}" }
+add = { X-Matched-Prefix = "{prefix}" }
+remove = ["X-Internal"]`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+	req.RemoteAddr = "10.0.0.7:51234"
+	req.Header.Set("X-Internal", "secret")
+	req.Header.Set("X-Custom-Header", "custom-value")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if receivedHost != "internal.example.com" {
+		t.Errorf("expected Host to be overridden, got '%s'", receivedHost)
+	}
+	if receivedHeaders.Get("X-Client-IP") != "10.0.0.7" {
+		t.Errorf("expected X-Client-IP '10.0.0.7', got '%s'", receivedHeaders.Get("X-Client-IP"))
+	}
+	if receivedHeaders.Get("X-Tenant") != "acme" {
+		t.Errorf("expected X-Tenant 'acme', got '%s'", receivedHeaders.Get("X-Tenant"))
+	}
+	if receivedHeaders.Get("X-Matched-Prefix") != "/api" {
+		t.Errorf("expected X-Matched-Prefix '/api', got '%s'", receivedHeaders.Get("X-Matched-Prefix"))
+	}
+	if receivedHeaders.Get("X-Internal") != "" {
+		t.Errorf("expected X-Internal to be removed")
+	}
+	if receivedHeaders.Get("X-Custom-Header") != "custom-value" {
+		t.Errorf("expected X-Custom-Header to be forwarded")
+	}
+}
+
+func TestProxyHeaders_HopByHopRemoved(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	var receivedHeaders http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedHeaders = r.Header
+		w.Header().Set("Connection", "X-Upstream-Hop")
+		w.Header().Set("X-Upstream-Hop", "1")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("X-End-To-End", "1")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+	req.Header.Set("Connection", "X-Client-Hop")
+	req.Header.Set("X-Client-Hop", "1")
+	req.Header.Set("Keep-Alive", "timeout=5")
+	req.Header.Set("Proxy-Authorization", "Basic dXNlcjpwYXNz")
+	req.Header.Set("X-Custom-Header", "custom-value")
 	rr := httptest.NewRecorder()
 
 	handler.ServeHTTP(rr, req)
 
+	for _, name := range []string{"X-Client-Hop", "Keep-Alive", "Proxy-Authorization"} {
+		if receivedHeaders.Get(name) != "" {
+			t.Errorf("expected request header %s to be removed", name)
+		}
+	}
 	if receivedHeaders.Get("X-Custom-Header") != "custom-value" {
 		t.Errorf("expected X-Custom-Header to be forwarded")
 	}
-	if receivedHeaders.Get("Authorization") != "Bearer token123" {
-		t.Errorf("expected Authorization header to be forwarded")
+
+	for _, name := range []string{"Connection", "X-Upstream-Hop", "Keep-Alive"} {
+		if rr.Header().Get(name) != "" {
+			t.Errorf("expected response header %s to be removed", name)
+		}
+	}
+	if rr.Header().Get("X-End-To-End") != "1" {
+		t.Errorf("expected X-End-To-End to be forwarded")
+	}
+}
+
+func TestProxyHeaders_Forwarding(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		expectedFor    string
+		expectedProto  string
+		expectedClient string
+		expectedFwd    string
+	}{
+		{
+			name:           "untrusted client headers are replaced",
+			expectedFor:    "192.0.2.1",
+			expectedProto:  "http",
+			expectedClient: "192.0.2.1",
+			expectedFwd:    "for=192.0.2.1;host=example.com;proto=http",
+		},
+		{
+			name:           "trusted proxy headers are extended",
+			trustedProxies: []string{"192.0.2.0/24", "10.0.0.1"},
+			expectedFor:    "203.0.113.7, 10.0.0.1, 192.0.2.1",
+			expectedProto:  "https",
+			expectedClient: "203.0.113.7",
+			expectedFwd:    "for=203.0.113.7, for=192.0.2.1;host=example.com;proto=http",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB, cleanupDB := setupTestDB()
+			defer cleanupDB()
+
+			var receivedHeaders http.Header
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				receivedHeaders = r.Header
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer upstream.Close()
+
+			configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"
+
+[proxy.requestHeaders]
+set = { X-Client-IP = "{clientIP}" }`
+
+			conf, cleanupConfig := createTestConfig(configContent)
+			defer cleanupConfig()
+			conf.Forwarding = config.Forwarding{XForwarded: true, Forwarded: true, Via: true, TrustedProxies: tt.trustedProxies}
+
+			handler := newTestProxyHandler(testDB, conf)
+
+			// httptest requests come from 192.0.2.1 to example.com.
+			req := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+			req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+			req.Header.Set("X-Forwarded-Proto", "https")
+			req.Header.Set("Forwarded", "for=203.0.113.7")
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if got := receivedHeaders.Get("X-Forwarded-For"); got != tt.expectedFor {
+				t.Errorf("expected X-Forwarded-For '%s', got '%s'", tt.expectedFor, got)
+			}
+			if got := receivedHeaders.Get("X-Forwarded-Proto"); got != tt.expectedProto {
+				t.Errorf("expected X-Forwarded-Proto '%s', got '%s'", tt.expectedProto, got)
+			}
+			if got := receivedHeaders.Get("X-Forwarded-Host"); got != "example.com" {
+				t.Errorf("expected X-Forwarded-Host 'example.com', got '%s'", got)
+			}
+			if got := receivedHeaders.Get("Forwarded"); got != tt.expectedFwd {
+				t.Errorf("expected Forwarded '%s', got '%s'", tt.expectedFwd, got)
+			}
+			if got := receivedHeaders.Get("X-Client-IP"); got != tt.expectedClient {
+				t.Errorf("expected X-Client-IP '%s', got '%s'", tt.expectedClient, got)
+			}
+			if got := receivedHeaders.Get("Via"); got != "1.1 proxymini" {
+				t.Errorf("expected Via '1.1 proxymini', got '%s'", got)
+			}
+			if got := rr.Header().Get("Via"); got != "1.1 proxymini" {
+				t.Errorf("expected response Via '1.1 proxymini', got '%s'", got)
+			}
+		})
 	}
 }
 
@@ -143,6 +1063,110 @@ target = "` + upstream.URL + `"`
 	}
 }
 
+func TestProxyRequestBody_Streamed(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	firstChunk := make(chan string, 1)
+	var receivedBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chunk := make([]byte, 5)
+		io.ReadFull(r.Body, chunk)
+		firstChunk <- string(chunk)
+
+		rest, _ := io.ReadAll(r.Body)
+		receivedBody = string(chunk) + string(rest)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	bodyReader, bodyWriter := io.Pipe()
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", bodyReader)
+	req.ContentLength = -1
+	rr := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(rr, req)
+		close(done)
+	}()
+
+	bodyWriter.Write([]byte("hello"))
+
+	// The upstream gets the beginning of the body while the client is still sending the rest.
+	select {
+	case chunk := <-firstChunk:
+		if chunk != "hello" {
+			t.Errorf("expected first chunk 'hello', got '%s'", chunk)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected request body to be streamed to the upstream")
+	}
+
+	bodyWriter.Write([]byte(" world"))
+	bodyWriter.Close()
+	<-done
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if receivedBody != "hello world" {
+		t.Errorf("expected body 'hello world', got '%s'", receivedBody)
+	}
+}
+
+func TestProxyRetry_ResendsRequestBody(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	var receivedBodies []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		receivedBodies = append(receivedBodies, string(body))
+		if len(receivedBodies) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"
+
+[proxy.retry]
+maxAttempts = 2
+retryOnStatus = [503]
+backoff = "1ms"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/items/1", bytes.NewBufferString("payload"))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if len(receivedBodies) != 2 || receivedBodies[0] != "payload" || receivedBodies[1] != "payload" {
+		t.Errorf("expected both attempts to send 'payload', got %q", receivedBodies)
+	}
+}
+
 func TestProxyResponseHeaders_Preserved(t *testing.T) {
 	testDB, cleanupDB := setupTestDB()
 	defer cleanupDB()
@@ -176,6 +1200,46 @@ target = "` + upstream.URL + `"`
 	}
 }
 
+func TestProxyResponseHeaders_Rules(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Powered-By", "internal-framework")
+		w.Header().Set("X-Response-Header", "response-value")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"
+
+[proxy.responseHeaders]
+set = { X-Served-For = "{host}" }
+remove = ["X-Powered-By"]`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	req := httptest.NewRequest(http.MethodGet, "http://app.local/api/test", nil)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Header().Get("X-Powered-By") != "" {
+		t.Errorf("expected X-Powered-By to be removed")
+	}
+	if rr.Header().Get("X-Served-For") != "app.local" {
+		t.Errorf("expected X-Served-For 'app.local', got '%s'", rr.Header().Get("X-Served-For"))
+	}
+	if rr.Header().Get("X-Response-Header") != "response-value" {
+		t.Errorf("expected X-Response-Header to be preserved")
+	}
+}
+
 func TestProxyResponseBody_Preserved(t *testing.T) {
 	testDB, cleanupDB := setupTestDB()
 	defer cleanupDB()
@@ -267,6 +1331,141 @@ target = "` + upstream.URL + `"`
 	}
 }
 
+func TestProxyRewrite(t *testing.T) {
+	tests := []struct {
+		name        string
+		route       string
+		rewrite     string
+		requestURL  string
+		expectedURL string
+	}{
+		{
+			name:        "keep prefix",
+			route:       `prefix = "/api"`,
+			rewrite:     `keepPrefix = true`,
+			requestURL:  "/api/users",
+			expectedURL: "/api/users",
+		},
+		{
+			name:        "replace prefix",
+			route:       `prefix = "/api"`,
+			rewrite:     `replacePrefix = "/v2"`,
+			requestURL:  "/api/users?limit=10",
+			expectedURL: "/v2/users?limit=10",
+		},
+		{
+			name:        "add prefix",
+			route:       `prefix = "/api"`,
+			rewrite:     `addPrefix = "/internal"`,
+			requestURL:  "/api/users",
+			expectedURL: "/internal/users",
+		},
+		{
+			name:        "keep and add prefix",
+			route:       `prefix = "/api"`,
+			rewrite:     "keepPrefix = true\naddPrefix = \"/gateway\"",
+			requestURL:  "/api/users",
+			expectedURL: "/gateway/api/users",
+		},
+		{
+			name:  "ordered regex substitutions",
+			route: `prefix = "/api"`,
+			rewrite: `regex = [
+  { pattern = "^/users/(\\d+)$", replacement = "/accounts/$1" },
+  { pattern = "/accounts/", replacement = "/members/" },
+]`,
+			requestURL:  "/api/users/42",
+			expectedURL: "/members/42",
+		},
+		{
+			name:        "replace prefix of regex route",
+			route:       `pathRegex = "^/v[0-9]+"`,
+			rewrite:     `replacePrefix = "/latest"`,
+			requestURL:  "/v3/items",
+			expectedURL: "/latest/items",
+		},
+		{
+			name:        "query rewrite",
+			route:       `prefix = "/api"`,
+			rewrite:     "[proxy.rewrite.query]\nadd = { source = \"proxy\" }\nremove = [\"debug\"]\nrename = { q = \"search\" }",
+			requestURL:  "/api/users?q=bob&debug=1",
+			expectedURL: "/users?search=bob&source=proxy",
+		},
+		{
+			name:        "query kept as is without query rules",
+			route:       `prefix = "/api"`,
+			rewrite:     `addPrefix = "/v1"`,
+			requestURL:  "/api/users?b=2&a=1",
+			expectedURL: "/v1/users?b=2&a=1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB, cleanupDB := setupTestDB()
+			defer cleanupDB()
+
+			var receivedURL string
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				receivedURL = r.URL.Path
+				if r.URL.RawQuery != "" {
+					receivedURL += "?" + r.URL.RawQuery
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer upstream.Close()
+
+			configContent := `[[proxy]]
+` + tt.route + `
+target = "` + upstream.URL + `"
+
+[proxy.rewrite]
+` + tt.rewrite
+
+			conf, cleanupConfig := createTestConfig(configContent)
+			defer cleanupConfig()
+
+			handler := newTestProxyHandler(testDB, conf)
+
+			req := httptest.NewRequest(http.MethodGet, tt.requestURL, nil)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if receivedURL != tt.expectedURL {
+				t.Errorf("expected URL '%s', got '%s'", tt.expectedURL, receivedURL)
+			}
+		})
+	}
+}
+
+func TestProxyRewrite_InvalidConfig(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "http://localhost:9999"
+
+[proxy.rewrite]
+keepPrefix = true
+replacePrefix = "/v2"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+}
+
 func TestProxyInsecureTLSSkipVerify(t *testing.T) {
 	testDB, cleanupDB := setupTestDB()
 	defer cleanupDB()
@@ -302,6 +1501,178 @@ insecureTLSSkipVerify = true`
 	}
 }
 
+func TestProxyUpstreamTLS_CAFileAndClientCertificate(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.ServerName))
+	}))
+	upstream.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	upstream.StartTLS()
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw}), 0o644)
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	if _, err := certs.EnsureSelfSigned(certFile, keyFile); err != nil {
+		t.Fatalf("failed to generate client certificate: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		clientCert     string
+		expectedStatus int
+	}{
+		{"with client certificate", `
+clientCertFile = "` + certFile + `"
+clientKeyFile = "` + keyFile + `"`, http.StatusOK},
+		{"without client certificate", "", http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"
+caFile = "` + caFile + `"
+serverName = "example.com"
+minTLSVersion = "1.2"` + tt.clientCert
+
+			conf, cleanupConfig := createTestConfig(configContent)
+			defer cleanupConfig()
+
+			rr := httptest.NewRecorder()
+			newTestProxyHandler(testDB, conf).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/test", nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus == http.StatusOK && rr.Body.String() != "example.com" {
+				t.Errorf("expected serverName to be sent as SNI, got '%s'", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestProxyUpstreamTLS_InvalidConfig(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	tests := []struct {
+		name           string
+		options        string
+		expectedStatus int
+	}{
+		{"unknown TLS version", `minTLSVersion = "2.0"`, http.StatusInternalServerError},
+		{"client certificate without key", `clientCertFile = "client.crt"`, http.StatusInternalServerError},
+		{"missing CA file", `caFile = "/nonexistent/ca.pem"`, http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configContent := `[[proxy]]
+prefix = "/api"
+target = "https://localhost:1"
+` + tt.options
+
+			conf, cleanupConfig := createTestConfig(configContent)
+			defer cleanupConfig()
+
+			rr := httptest.NewRecorder()
+			newTestProxyHandler(testDB, conf).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/test", nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestProxyProtocol_H2CBothSides(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	upstream.Config.Protocols = h2cProtocols()
+	upstream.Start()
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + upstream.URL + `"
+protocol = "h2c"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	rlSvc := requestlog.NewRequestLogService(testDB)
+	proxyServer := httptest.NewUnstartedServer(proxy.NewProxyHandler(rlSvc, conf))
+	proxyServer.Config.Protocols = h2cProtocols()
+	proxyServer.Start()
+	defer proxyServer.Close()
+
+	transport := &http.Transport{Protocols: new(http.Protocols)}
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Get(proxyServer.URL + "/api/proto")
+	if err != nil {
+		t.Fatalf("failed to make request: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "HTTP/2.0" {
+		t.Errorf("expected upstream to be reached over HTTP/2, got '%s'", string(body))
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	logs, err := rlSvc.GetList()
+	if err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 log, got %d", len(logs))
+	}
+	if logs[0].Protocol != "HTTP/2.0" || logs[0].UpstreamProtocol != "HTTP/2.0" {
+		t.Errorf("expected HTTP/2.0 on both sides, got '%s' and '%s'", logs[0].Protocol, logs[0].UpstreamProtocol)
+	}
+}
+
+func TestProxyProtocol_InvalidConfig(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "http://localhost:1"
+protocol = "spdy"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	proxyHandler := newTestProxyHandler(testDB, conf)
+
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/test", nil))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d for an unknown protocol, got %d", http.StatusInternalServerError, rr.Code)
+	}
+}
+
+func h2cProtocols() *http.Protocols {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	return protocols
+}
+
 func setupTestDB() (*sqlx.DB, func()) {
 	testDB, err := sqlx.Connect("sqlite", ":memory:")
 	if err != nil {
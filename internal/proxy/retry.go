@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/mishankov/proxymini/internal/config"
+)
+
+const (
+	defaultRetryBackoff    = 100 * time.Millisecond
+	defaultRetryMaxBackoff = 2 * time.Second
+)
+
+// idempotentMethods are the methods that are retried by default, see RFC 9110, section 9.2.2.
+var idempotentMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete,
+}
+
+// retryPolicy decides whether a failed attempt of a request is retried and how long to wait before that.
+type retryPolicy struct {
+	config.Retry
+	enabled bool
+}
+
+func newRetryPolicy(retry config.Retry, method string) retryPolicy {
+	enabled := retry.MaxAttempts > 1 && (retry.AllowNonIdempotent || slices.Contains(idempotentMethods, method))
+
+	return retryPolicy{Retry: retry, enabled: enabled}
+}
+
+// shouldRetry reports whether the attempt with the given number, which got resp or err, should be retried.
+func (p retryPolicy) shouldRetry(attempt int, resp *http.Response, err error) bool {
+	if !p.enabled || attempt >= p.MaxAttempts {
+		return false
+	}
+
+	if err != nil {
+		return p.RetryOnConnectionErrors
+	}
+
+	return slices.Contains(p.RetryOnStatus, resp.StatusCode)
+}
+
+// backoff returns the delay before the next attempt after the given one:
+// exponential backoff with full jitter, capped by MaxBackoff.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	base := p.Backoff
+	if base <= 0 {
+		base = defaultRetryBackoff
+	}
+	limit := p.MaxBackoff
+	if limit <= 0 {
+		limit = defaultRetryMaxBackoff
+	}
+
+	delay := limit
+	if shift := attempt - 1; shift < 32 && base<<shift < limit {
+		delay = base << shift
+	}
+
+	return rand.N(delay + 1)
+}
+
+// sleep waits for d or until ctx is done. It returns false in the latter case.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"github.com/mishankov/proxymini/internal/config"
+)
+
+// rewriter changes the path and query of a request before it is sent to a target.
+type rewriter struct {
+	config.Rewrite
+	regex []*regexp.Regexp
+}
+
+func newRewriter(rewrite config.Rewrite) (*rewriter, error) {
+	if rewrite.KeepPrefix && rewrite.ReplacePrefix != "" {
+		return nil, fmt.Errorf("keepPrefix and replacePrefix can't be used together")
+	}
+
+	rw := &rewriter{Rewrite: rewrite}
+	for i, rule := range rewrite.Regex {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex rewrite #%d: %w", i+1, err)
+		}
+		rw.regex = append(rw.regex, re)
+	}
+
+	return rw, nil
+}
+
+// path returns the path to append to the target for a request path whose beginning matched the route.
+func (rw *rewriter) path(path, prefix string) string {
+	rest := path[len(prefix):]
+	switch {
+	case rw.KeepPrefix:
+		rest = path
+	case rw.ReplacePrefix != "":
+		rest = joinURLPath(rw.ReplacePrefix, rest)
+	}
+
+	if rw.AddPrefix != "" {
+		rest = joinURLPath(rw.AddPrefix, rest)
+	}
+
+	for i, re := range rw.regex {
+		rest = re.ReplaceAllString(rest, rw.Regex[i].Replacement)
+	}
+
+	return rest
+}
+
+// query returns the query string to send to the target. Parameters are removed first, then renamed, then added.
+// Without query rules the original query string is kept as is.
+func (rw *rewriter) query(rawQuery string) string {
+	rules := rw.Query
+	if len(rules.Remove) == 0 && len(rules.Rename) == 0 && len(rules.Add) == 0 {
+		return rawQuery
+	}
+
+	values, _ := url.ParseQuery(rawQuery)
+
+	for _, name := range rules.Remove {
+		values.Del(name)
+	}
+
+	for from, to := range rules.Rename {
+		if vs, ok := values[from]; ok {
+			delete(values, from)
+			values[to] = append(values[to], vs...)
+		}
+	}
+
+	for name, value := range rules.Add {
+		values.Add(name, value)
+	}
+
+	return values.Encode()
+}
@@ -0,0 +1,376 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/mishankov/proxymini/internal/config"
+)
+
+// route is a [[proxy]] entry together with its position in the config file.
+type route struct {
+	config.Proxy
+	index       int
+	pathRegex   *regexp.Regexp
+	headerRegex map[string]*regexp.Regexp
+	rewriter    *rewriter
+	// forward marks the routes of forward proxy requests, which go to the origin in the request URI.
+	forward bool
+}
+
+// router selects a route for an incoming request.
+// Routes are kept sorted so that the first matching route is the most specific one:
+// regex routes first, then longest prefix, then highest priority, then routes with more match conditions,
+// then the most specific host, then config file order.
+type router struct {
+	routes []*route
+}
+
+func newRouter(proxies []config.Proxy) (*router, error) {
+	routes := make([]*route, 0, len(proxies))
+	for i, proxy := range proxies {
+		route := &route{Proxy: proxy, index: i}
+
+		if err := validateBalancing(proxy); err != nil {
+			return nil, fmt.Errorf("proxy #%d: %w", i+1, err)
+		}
+
+		if err := validateProtocol(proxy.Protocol); err != nil {
+			return nil, fmt.Errorf("proxy #%d: %w", i+1, err)
+		}
+
+		if err := validateTLS(proxy); err != nil {
+			return nil, fmt.Errorf("proxy #%d: %w", i+1, err)
+		}
+
+		if err := validateUpstreamProxy(proxy.UpstreamProxy); err != nil {
+			return nil, fmt.Errorf("proxy #%d: %w", i+1, err)
+		}
+
+		if err := validateUnixTargets(proxy); err != nil {
+			return nil, fmt.Errorf("proxy #%d: %w", i+1, err)
+		}
+
+		if proxy.PathRegex != "" {
+			re, err := regexp.Compile(proxy.PathRegex)
+			if err != nil {
+				return nil, fmt.Errorf("proxy #%d: invalid pathRegex: %w", i+1, err)
+			}
+			route.pathRegex = re
+		}
+
+		rw, err := newRewriter(proxy.Rewrite)
+		if err != nil {
+			return nil, fmt.Errorf("proxy #%d: %w", i+1, err)
+		}
+		route.rewriter = rw
+
+		for name, pattern := range proxy.Match.HeaderRegex {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("proxy #%d: invalid headerRegex for %s: %w", i+1, name, err)
+			}
+			if route.headerRegex == nil {
+				route.headerRegex = map[string]*regexp.Regexp{}
+			}
+			route.headerRegex[name] = re
+		}
+
+		routes = append(routes, route)
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		return routes[i].ranksAbove(routes[j])
+	})
+
+	return &router{routes: routes}, nil
+}
+
+// match returns the most specific route for the request or nil if there is none.
+func (rt *router) match(r *http.Request) *route {
+	for _, route := range rt.routes {
+		if route.matches(r) {
+			return route
+		}
+	}
+
+	return nil
+}
+
+// shadowed returns descriptions of routes that can never be selected because another route
+// with the same path pattern, a broader or equal host and no match conditions always wins over them.
+// Longer prefixes go before shorter ones whatever their priority, so a shorter prefix never shadows a longer one.
+func (rt *router) shadowed() []string {
+	var res []string
+
+	for i, route := range rt.routes {
+		for _, other := range rt.routes[:i] {
+			if other.conditions() == 0 && other.pathPattern() == route.pathPattern() && hostCovers(other.Host, route.Host) {
+				res = append(res, fmt.Sprintf("proxy #%d (host %q, %s) is shadowed by proxy #%d (host %q, %s)",
+					route.index+1, route.Host, route.pathPattern(), other.index+1, other.Host, other.pathPattern()))
+				break
+			}
+		}
+	}
+
+	return res
+}
+
+func (r *route) ranksAbove(other *route) bool {
+	if (r.pathRegex != nil) != (other.pathRegex != nil) {
+		return r.pathRegex != nil
+	}
+
+	if r.pathRegex == nil && len(r.Prefix) != len(other.Prefix) {
+		return len(r.Prefix) > len(other.Prefix)
+	}
+
+	if r.Priority != other.Priority {
+		return r.Priority > other.Priority
+	}
+
+	if r.conditions() != other.conditions() {
+		return r.conditions() > other.conditions()
+	}
+
+	if hostSpecificity(r.Host) != hostSpecificity(other.Host) {
+		return hostSpecificity(r.Host) > hostSpecificity(other.Host)
+	}
+
+	return r.index < other.index
+}
+
+// pathPattern describes the path part of the route for logging.
+func (r *route) pathPattern() string {
+	if r.pathRegex != nil {
+		return fmt.Sprintf("pathRegex %q", r.PathRegex)
+	}
+
+	return fmt.Sprintf("prefix %q", r.Prefix)
+}
+
+// key identifies the route across config reloads.
+func (r *route) key() string {
+	return fmt.Sprintf("%s %s %v", r.Host, r.pathPattern(), r.Match)
+}
+
+// targets returns the upstream targets of the route. A single target is treated as a list of one.
+// Targets without a weight get a weight of 1.
+func (r *route) targets() []config.Target {
+	if len(r.Targets) == 0 {
+		return []config.Target{{URL: r.Target, Weight: 1}}
+	}
+
+	res := make([]config.Target, 0, len(r.Targets))
+	for _, target := range r.Targets {
+		if target.Weight == 0 {
+			target.Weight = 1
+		}
+		res = append(res, target)
+	}
+
+	return res
+}
+
+// conditions returns the number of match conditions of the route.
+func (r *route) conditions() int {
+	res := len(r.Match.Headers) + len(r.Match.HeaderRegex) + len(r.Match.Query)
+	if len(r.Match.Methods) > 0 {
+		res++
+	}
+
+	return res
+}
+
+func (r *route) matches(req *http.Request) bool {
+	if !matchHost(r.Host, req.Host) {
+		return false
+	}
+
+	if r.pathRegex != nil {
+		if !r.pathRegex.MatchString(req.URL.Path) {
+			return false
+		}
+	} else if !matchPrefix(r.Prefix, req.URL.Path) {
+		return false
+	}
+
+	return r.matchConditions(req)
+}
+
+// matchConditions reports whether the request satisfies the match block of the route.
+func (r *route) matchConditions(req *http.Request) bool {
+	if len(r.Match.Methods) > 0 && !slices.ContainsFunc(r.Match.Methods, func(method string) bool {
+		return strings.EqualFold(method, req.Method)
+	}) {
+		return false
+	}
+
+	for name, value := range r.Match.Headers {
+		if !slices.Contains(headerValues(req.Header, name), value) {
+			return false
+		}
+	}
+
+	for name, re := range r.headerRegex {
+		if !slices.ContainsFunc(headerValues(req.Header, name), re.MatchString) {
+			return false
+		}
+	}
+
+	if len(r.Match.Query) > 0 {
+		query := req.URL.Query()
+		for _, name := range r.Match.Query {
+			if !query.Has(name) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// headerValues returns all values of the header for matching. Comma-joined lists are split into their elements
+// in addition to the whole value, so a repeated header and a list match the same way.
+// A missing header has a single empty value, so it matches an empty value or a regex that allows one.
+func headerValues(h http.Header, name string) []string {
+	values := h.Values(name)
+	if len(values) == 0 {
+		return []string{""}
+	}
+
+	res := slices.Clone(values)
+	for _, value := range values {
+		if !strings.Contains(value, ",") {
+			continue
+		}
+		for _, element := range strings.Split(value, ",") {
+			res = append(res, strings.TrimSpace(element))
+		}
+	}
+
+	return res
+}
+
+// targetURL builds the upstream URL for the request sent to the given target.
+// For prefix routes the matched prefix is replaced with the target. For regex routes the target
+// is expanded with the capture groups of the match and the rest of the path after the match is appended.
+func (r *route) targetURL(req *http.Request, target string) string {
+	path := req.URL.Path
+	prefix := r.Prefix
+	if r.pathRegex != nil {
+		loc := r.pathRegex.FindStringSubmatchIndex(path)
+		target = string(r.pathRegex.ExpandString(nil, target, path, loc))
+		prefix = path[:loc[1]]
+	}
+
+	targetURL := joinURLPath(target, r.rewriter.path(path, prefix))
+
+	if query := r.rewriter.query(req.URL.RawQuery); query != "" {
+		targetURL += "?" + query
+	}
+	if req.URL.Fragment != "" {
+		targetURL += "#" + req.URL.Fragment
+	}
+
+	return targetURL
+}
+
+// matchedPrefix returns the part of the request path matched by the route.
+func (r *route) matchedPrefix(req *http.Request) string {
+	if r.pathRegex != nil {
+		return r.pathRegex.FindString(req.URL.Path)
+	}
+
+	return r.Prefix
+}
+
+// matchPrefix reports whether path starts with prefix on a path segment boundary,
+// so "/api" matches "/api" and "/api/users", but not "/apiv2".
+func matchPrefix(prefix, path string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+
+	if prefix == "" || strings.HasSuffix(prefix, "/") || len(path) == len(prefix) {
+		return true
+	}
+
+	return path[len(prefix)] == '/'
+}
+
+// joinURLPath appends path to base making sure there is exactly one slash between them.
+func joinURLPath(base, path string) string {
+	if path == "" {
+		return base
+	}
+
+	baseSlash := strings.HasSuffix(base, "/")
+	pathSlash := strings.HasPrefix(path, "/")
+
+	switch {
+	case baseSlash && pathSlash:
+		return base + path[1:]
+	case !baseSlash && !pathSlash:
+		return base + "/" + path
+	}
+
+	return base + path
+}
+
+// matchHost reports whether the request host matches the configured host pattern.
+// An empty pattern matches any host. A pattern starting with "*." matches any subdomain
+// of the rest of the pattern. The port of the request host is ignored unless the pattern has one.
+func matchHost(pattern, host string) bool {
+	if pattern == "" {
+		return true
+	}
+
+	pattern = strings.ToLower(pattern)
+	host = strings.ToLower(host)
+
+	if _, _, err := net.SplitHostPort(pattern); err != nil {
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+	}
+
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+
+	return host == pattern
+}
+
+// hostSpecificity ranks host patterns: exact hosts above wildcards above no host at all.
+func hostSpecificity(pattern string) int {
+	switch {
+	case pattern == "":
+		return 0
+	case strings.HasPrefix(pattern, "*"):
+		return 1
+	}
+
+	return 2
+}
+
+// hostCovers reports whether every host matched by pattern b is also matched by pattern a.
+func hostCovers(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+
+	switch {
+	case a == "" || a == b:
+		return true
+	case b == "":
+		return false
+	case strings.HasPrefix(a, "*"):
+		return matchHost(a, strings.TrimPrefix(b, "*"))
+	}
+
+	return false
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/mishankov/proxymini/internal/requestlog"
+)
+
+const (
+	// maxStreamEventBytes is the number of bytes of a stream event kept in the log.
+	maxStreamEventBytes = 64 << 10
+	// maxStreamEvents is the number of events of a response kept in the log.
+	maxStreamEvents = 10_000
+)
+
+// streamingMediaTypes are the content types of responses whose events are recorded while the stream is live.
+var streamingMediaTypes = []string{"text/event-stream", "application/x-ndjson", "application/grpc"}
+
+// isStreamingResponse reports whether the response is a stream. Streams are detected by their content type:
+// one of streamingMediaTypes, a gRPC content type like application/grpc+proto, or one of the extra media types
+// configured for the route. Content types work the same way over HTTP/1.1 and HTTP/2.
+// Unless skipChunked is set, chunked responses of unknown length are streams too, whatever their content type.
+func isStreamingResponse(resp *http.Response, extra []string, skipChunked bool) bool {
+	if !skipChunked && resp.ContentLength < 0 && slices.Contains(resp.TransferEncoding, "chunked") {
+		return true
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "" {
+		return false
+	}
+
+	return slices.Contains(streamingMediaTypes, mediaType) || strings.HasPrefix(mediaType, "application/grpc+") ||
+		slices.ContainsFunc(extra, func(t string) bool { return strings.EqualFold(t, mediaType) })
+}
+
+func isEventStream(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
+
+// streamRecorder is an io.Writer that records the proxied bytes of a streaming response as events.
+// Server-Sent Events are split on blank lines, other streams are recorded chunk by chunk as they are read.
+type streamRecorder struct {
+	rlSvc        *requestlog.RequestLogService
+	requestLogID string
+	sse          bool
+	pending      bytes.Buffer
+	count        int
+}
+
+func (sr *streamRecorder) Write(p []byte) (int, error) {
+	if !sr.sse {
+		sr.record(p)
+		return len(p), nil
+	}
+
+	sr.pending.Write(p)
+	for {
+		end, next := eventBoundary(sr.pending.Bytes())
+		if end < 0 {
+			break
+		}
+
+		sr.record(sr.pending.Bytes()[:end])
+		sr.pending.Next(next)
+	}
+
+	// An event without an end in sight is recorded as is, so a broken stream can't grow the buffer forever.
+	if sr.pending.Len() > maxStreamEventBytes {
+		sr.flush()
+	}
+
+	return len(p), nil
+}
+
+// flush records the rest of an event that was not terminated by a blank line.
+func (sr *streamRecorder) flush() {
+	if sr.pending.Len() > 0 {
+		sr.record(sr.pending.Bytes())
+		sr.pending.Reset()
+	}
+}
+
+func (sr *streamRecorder) record(data []byte) {
+	sr.count++
+	if sr.count > maxStreamEvents {
+		return
+	}
+
+	sr.rlSvc.SaveEvent(requestlog.NewStreamEvent(sr.requestLogID, int64(len(data)), data[:min(len(data), maxStreamEventBytes)]))
+}
+
+// eventBoundary returns the end of the first event in buf and the start of the data after it,
+// or -1 if buf holds no complete event. Events end with a blank line, see the HTML Living Standard, section 9.2.6.
+func eventBoundary(buf []byte) (end, next int) {
+	end = -1
+	for _, sep := range []string{"\n\n", "\r\n\r\n", "\r\r"} {
+		if i := bytes.Index(buf, []byte(sep)); i >= 0 && (end < 0 || i < end) {
+			end, next = i, i+len(sep)
+		}
+	}
+
+	return end, next
+}
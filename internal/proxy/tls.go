@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/mishankov/proxymini/internal/certs"
+	"github.com/mishankov/proxymini/internal/config"
+)
+
+// tlsVersions are the values of minTLSVersion.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func validateTLS(proxy config.Proxy) error {
+	if _, ok := tlsVersions[proxy.MinTLSVersion]; proxy.MinTLSVersion != "" && !ok {
+		return fmt.Errorf("unknown minTLSVersion %q, expected 1.0, 1.1, 1.2 or 1.3", proxy.MinTLSVersion)
+	}
+
+	if (proxy.ClientCertFile == "") != (proxy.ClientKeyFile == "") {
+		return fmt.Errorf("clientCertFile and clientKeyFile must be set together")
+	}
+
+	return nil
+}
+
+// newTLSConfig returns the TLS settings of connections to upstreams, or nil for the defaults.
+func newTLSConfig(key transportKey) (*tls.Config, error) {
+	if !key.insecureTLSSkipVerify && key.caFile == "" && key.clientCertFile == "" && key.serverName == "" && key.minTLSVersion == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: key.insecureTLSSkipVerify,
+		ServerName:         key.serverName,
+		MinVersion:         tlsVersions[key.minTLSVersion],
+	}
+
+	if key.caFile != "" {
+		pem, err := os.ReadFile(key.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading caFile: %w", err)
+		}
+
+		// The CA bundle is trusted in addition to the system roots, so public upstreams keep working.
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in caFile %s", key.caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if key.clientCertFile != "" {
+		reloader, err := certs.NewReloader(key.clientCertFile, key.clientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return reloader.GetCertificate(nil)
+		}
+	}
+
+	return tlsConfig, nil
+}
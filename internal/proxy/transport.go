@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+const defaultDialTimeout = 30 * time.Second
+
+// Protocols a route can speak to its upstreams. By default HTTP/2 is used for https:// targets that support it
+// and HTTP/1.1 for everything else.
+const (
+	protocolHTTP1 = "http1"
+	// protocolH2 requires HTTP/2 negotiated over TLS.
+	protocolH2 = "h2"
+	// protocolH2C uses HTTP/2 over cleartext connections with prior knowledge, see RFC 9113, section 3.3.
+	protocolH2C = "h2c"
+	// protocolGRPC uses HTTP/2 over TLS for https:// targets and h2c for http:// targets, see grpc.go.
+	protocolGRPC = "grpc"
+)
+
+func validateProtocol(protocol string) error {
+	switch protocol {
+	case "", protocolHTTP1, protocolH2, protocolH2C, protocolGRPC:
+		return nil
+	}
+
+	return fmt.Errorf("unknown protocol %q, expected %q, %q, %q or %q", protocol, protocolHTTP1, protocolH2, protocolH2C, protocolGRPC)
+}
+
+// transportKey holds the route settings that need a dedicated transport.
+// Routes with equal keys share a transport and its connection pool.
+type transportKey struct {
+	protocol              string
+	insecureTLSSkipVerify bool
+	caFile                string
+	clientCertFile        string
+	clientKeyFile         string
+	serverName            string
+	minTLSVersion         string
+	upstreamProxy         string
+	unixSocket            string
+	dialTimeout           time.Duration
+	tlsHandshakeTimeout   time.Duration
+	responseHeaderTimeout time.Duration
+}
+
+func transportKeyFor(route *route) transportKey {
+	return transportKey{
+		protocol:              route.Protocol,
+		insecureTLSSkipVerify: route.InsecureTLSSkipVerify,
+		caFile:                route.CAFile,
+		clientCertFile:        route.ClientCertFile,
+		clientKeyFile:         route.ClientKeyFile,
+		serverName:            route.ServerName,
+		minTLSVersion:         route.MinTLSVersion,
+		upstreamProxy:         route.UpstreamProxy,
+		dialTimeout:           route.DialTimeout,
+		tlsHandshakeTimeout:   route.TLSHandshakeTimeout,
+		responseHeaderTimeout: route.ResponseHeaderTimeout,
+	}
+}
+
+// clientForKey returns the HTTP client for the transport settings. Clients that fail to be created,
+// for example because of a missing CA file, are not cached, so fixing the files is enough.
+func (ph *ProxyHandler) clientForKey(key transportKey) (*http.Client, error) {
+	ph.clientsMu.Lock()
+	defer ph.clientsMu.Unlock()
+
+	if client, ok := ph.clients[key]; ok {
+		return client, nil
+	}
+
+	transport, err := newTransport(key)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Transport: transport}
+	ph.clients[key] = client
+
+	return client, nil
+}
+
+func newTransport(key transportKey) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	dialer := &net.Dialer{Timeout: defaultDialTimeout, KeepAlive: 30 * time.Second}
+	if key.dialTimeout > 0 {
+		dialer.Timeout = key.dialTimeout
+	}
+	transport.DialContext = dialer.DialContext
+
+	// Requests to Unix socket targets are sent to localhost, the socket is dialed instead.
+	if key.unixSocket != "" {
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", key.unixSocket)
+		}
+	}
+
+	if key.upstreamProxy != "" {
+		if err := useUpstreamProxy(transport, key.upstreamProxy); err != nil {
+			return nil, err
+		}
+	}
+
+	if key.tlsHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = key.tlsHandshakeTimeout
+	}
+	transport.ResponseHeaderTimeout = key.responseHeaderTimeout
+
+	tlsConfig, err := newTLSConfig(key)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	switch key.protocol {
+	case protocolHTTP1:
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetHTTP1(true)
+	case protocolH2:
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetHTTP2(true)
+	case protocolH2C:
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetUnencryptedHTTP2(true)
+	case protocolGRPC:
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetHTTP2(true)
+		transport.Protocols.SetUnencryptedHTTP2(true)
+	}
+
+	return transport, nil
+}
+
+// isTimeout reports whether err is caused by one of the route timeouts.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mishankov/proxymini/internal/config"
+)
+
+// unixScheme starts targets on Unix domain sockets, like unix:///run/app.sock or unix:///run/app.sock:/api
+// with an HTTP path base after the colon.
+const unixScheme = "unix://"
+
+// unixHost is the Host requests to Unix socket targets are sent with.
+const unixHost = "localhost"
+
+// validateUnixTargets checks the Unix socket targets of a route.
+func validateUnixTargets(proxy config.Proxy) error {
+	targets := []string{proxy.Target}
+	for _, target := range proxy.Targets {
+		targets = append(targets, target.URL)
+	}
+
+	for _, target := range targets {
+		rest, ok := strings.CutPrefix(target, unixScheme)
+		if !ok {
+			continue
+		}
+
+		if socket, _, _ := strings.Cut(rest, ":"); socket == "" {
+			return fmt.Errorf("target %s: missing socket path", target)
+		}
+		if proxy.UpstreamProxy != "" {
+			return fmt.Errorf("target %s: upstreamProxy can't be used with Unix socket targets", target)
+		}
+	}
+
+	return nil
+}
+
+// withUnixPathSeparator ends Unix socket targets without a path base with the colon that separates the socket path
+// from the HTTP path, so the request path can be appended to them.
+func withUnixPathSeparator(target string) string {
+	if rest, ok := strings.CutPrefix(target, unixScheme); ok && !strings.Contains(rest, ":") {
+		return target + ":"
+	}
+
+	return target
+}
+
+// resolveUnixTarget returns the URL to send a request for targetURL to. For Unix socket targets,
+// it is an http:// URL with the path and query of the target, and the socket is set in the transport key.
+// The target URL stays as it is in the log, as it shows where the request went.
+func resolveUnixTarget(targetURL string, key *transportKey) string {
+	rest, ok := strings.CutPrefix(targetURL, unixScheme)
+	if !ok {
+		return targetURL
+	}
+
+	socket, path, _ := strings.Cut(rest, ":")
+	key.unixSocket = socket
+
+	return "http://" + unixHost + path
+}
@@ -0,0 +1,123 @@
+package proxy_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mishankov/proxymini/internal/proxy"
+	"github.com/mishankov/proxymini/internal/requestlog"
+)
+
+// newUnixServer starts a test server on a Unix socket and returns the socket path.
+func newUnixServer(t *testing.T, handler http.Handler) string {
+	t.Helper()
+
+	// Socket paths are limited to about 100 bytes, which t.TempDir can exceed.
+	dir, err := os.MkdirTemp("", "proxymini")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "app.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = l
+	server.Start()
+	t.Cleanup(server.Close)
+
+	return socket
+}
+
+func TestProxyUnixSocket_ForwardsToSocket(t *testing.T) {
+	socket := newUnixServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host + " " + r.URL.RequestURI()))
+	}))
+
+	tests := []struct {
+		name         string
+		target       string
+		expectedBody string
+		expectedURL  string
+	}{
+		{"socket only", "unix://" + socket, "localhost /users?id=1", "unix://" + socket + ":/users?id=1"},
+		{"with path base", "unix://" + socket + ":/v1.43", "localhost /v1.43/users?id=1", "unix://" + socket + ":/v1.43/users?id=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB, cleanupDB := setupTestDB()
+			defer cleanupDB()
+
+			configContent := `[[proxy]]
+prefix = "/api"
+target = "` + tt.target + `"`
+
+			conf, cleanupConfig := createTestConfig(configContent)
+			defer cleanupConfig()
+
+			rlSvc := requestlog.NewRequestLogService(testDB)
+			handler := proxy.NewProxyHandler(rlSvc, conf)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/users?id=1", nil))
+
+			if rr.Code != http.StatusOK || rr.Body.String() != tt.expectedBody {
+				t.Fatalf("expected 200 '%s', got %d '%s'", tt.expectedBody, rr.Code, rr.Body.String())
+			}
+
+			time.Sleep(100 * time.Millisecond)
+
+			logs, err := rlSvc.GetList()
+			if err != nil || len(logs) != 1 {
+				t.Fatalf("expected 1 log, got %d (%v)", len(logs), err)
+			}
+			if logs[0].URL != tt.expectedURL {
+				t.Errorf("expected logged URL '%s', got '%s'", tt.expectedURL, logs[0].URL)
+			}
+		})
+	}
+}
+
+func TestProxyUnixSocket_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name          string
+		configContent string
+	}{
+		{"missing socket path", `[[proxy]]
+prefix = "/api"
+target = "unix://:/api"`},
+		{"upstream proxy", `[[proxy]]
+prefix = "/api"
+target = "unix:///run/app.sock"
+upstreamProxy = "http://proxy:8080"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB, cleanupDB := setupTestDB()
+			defer cleanupDB()
+
+			conf, cleanupConfig := createTestConfig(tt.configContent)
+			defer cleanupConfig()
+
+			proxyHandler := newTestProxyHandler(testDB, conf)
+
+			rr := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/test", nil))
+
+			if rr.Code != http.StatusInternalServerError {
+				t.Errorf("expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+			}
+		})
+	}
+}
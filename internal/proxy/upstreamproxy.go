@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// validateUpstreamProxy checks the upstreamProxy of a route: an http://, https:// or socks5:// URL with optional credentials.
+func validateUpstreamProxy(upstreamProxy string) error {
+	if upstreamProxy == "" {
+		return nil
+	}
+
+	_, err := parseUpstreamProxy(upstreamProxy)
+	return err
+}
+
+func parseUpstreamProxy(upstreamProxy string) (*url.URL, error) {
+	u, err := url.Parse(upstreamProxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstreamProxy: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid upstreamProxy %q: expected an http, https or socks5 URL", u.Redacted())
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid upstreamProxy %q: missing host", u.Redacted())
+	}
+
+	return u, nil
+}
+
+// useUpstreamProxy makes the transport connect to targets through the proxy. Credentials in the URL are sent
+// as Proxy-Authorization to HTTP proxies and as username and password to SOCKS5 proxies.
+// Errors at the proxy are returned as upstreamProxyError.
+func useUpstreamProxy(transport *http.Transport, upstreamProxy string) error {
+	proxyURL, err := parseUpstreamProxy(upstreamProxy)
+	if err != nil {
+		return err
+	}
+	redacted := proxyURL.Redacted()
+
+	transport.Proxy = http.ProxyURL(proxyURL)
+
+	// With a proxy, the transport dials only the proxy itself.
+	dial := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, &upstreamProxyError{proxy: redacted, err: err}
+		}
+
+		return conn, nil
+	}
+
+	transport.OnProxyConnectResponse = func(_ context.Context, _ *url.URL, _ *http.Request, resp *http.Response) error {
+		if resp.StatusCode != http.StatusOK {
+			return &upstreamProxyError{proxy: redacted, err: fmt.Errorf("CONNECT responded with %s", resp.Status)}
+		}
+
+		return nil
+	}
+
+	return nil
+}
+
+// upstreamProxyError is an error at the upstream proxy of a route rather than at the target.
+type upstreamProxyError struct {
+	proxy string
+	err   error
+}
+
+func (e *upstreamProxyError) Error() string {
+	return fmt.Sprintf("upstream proxy %s: %v", e.proxy, e.err)
+}
+
+func (e *upstreamProxyError) Unwrap() error {
+	return e.err
+}
+
+// isUpstreamProxyError reports whether err happened at the upstream proxy: connecting to it, its TLS handshake,
+// a rejected CONNECT or a failed SOCKS5 handshake.
+func isUpstreamProxyError(err error) bool {
+	if errors.As(err, new(*upstreamProxyError)) {
+		return true
+	}
+
+	// The transport reports failed TLS handshakes with HTTPS proxies as "proxyconnect" and failed SOCKS5 handshakes as "socks ...".
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && (opErr.Op == "proxyconnect" || strings.HasPrefix(opErr.Op, "socks"))
+}
+
+// redactedUpstreamProxy returns the upstream proxy URL of a route without the password, for the log.
+func redactedUpstreamProxy(upstreamProxy string) string {
+	u, err := url.Parse(upstreamProxy)
+	if err != nil {
+		return ""
+	}
+
+	return u.Redacted()
+}
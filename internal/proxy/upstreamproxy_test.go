@@ -0,0 +1,279 @@
+package proxy_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mishankov/proxymini/internal/proxy"
+	"github.com/mishankov/proxymini/internal/requestlog"
+)
+
+func TestProxyUpstreamProxy_HTTPWithCredentials(t *testing.T) {
+	tests := []struct {
+		name   string
+		origin *httptest.Server
+	}{
+		{"http target", httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }))},
+		{"https target", httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.origin.Close()
+
+			testDB, cleanupDB := setupTestDB()
+			defer cleanupDB()
+
+			// Another ProxyMini in forward proxy mode serves as the upstream proxy.
+			proxyConf, cleanupProxyConfig := createTestConfig("")
+			defer cleanupProxyConfig()
+			proxyConf.AuthToken = "secret"
+			upstreamProxyDB, cleanupUpstreamProxyDB := setupTestDB()
+			defer cleanupUpstreamProxyDB()
+			forwardHandler := newTestProxyHandler(upstreamProxyDB, proxyConf)
+
+			var hits atomic.Int64
+			upstreamProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hits.Add(1)
+				forwardHandler.ServeForward(w, r)
+			}))
+			defer upstreamProxy.Close()
+
+			configContent := `[[proxy]]
+prefix = "/api"
+target = "` + tt.origin.URL + `"
+insecureTLSSkipVerify = true
+upstreamProxy = "http://user:secret@` + upstreamProxy.Listener.Addr().String() + `"`
+
+			conf, cleanupConfig := createTestConfig(configContent)
+			defer cleanupConfig()
+
+			rlSvc := requestlog.NewRequestLogService(testDB)
+			handler := proxy.NewProxyHandler(rlSvc, conf)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/test", nil))
+
+			if rr.Code != http.StatusOK || rr.Body.String() != "ok" {
+				t.Fatalf("expected 200 'ok', got %d '%s'", rr.Code, rr.Body.String())
+			}
+			if hits.Load() != 1 {
+				t.Errorf("expected the request to go through the upstream proxy, got %d requests there", hits.Load())
+			}
+
+			time.Sleep(100 * time.Millisecond)
+
+			logs, err := rlSvc.GetList()
+			if err != nil || len(logs) != 1 {
+				t.Fatalf("expected 1 log, got %d (%v)", len(logs), err)
+			}
+			if expected := "http://user:xxxxx@" + upstreamProxy.Listener.Addr().String(); logs[0].UpstreamProxy != expected {
+				t.Errorf("expected logged upstream proxy '%s', got '%s'", expected, logs[0].UpstreamProxy)
+			}
+		})
+	}
+}
+
+func TestProxyUpstreamProxy_SOCKS5(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	origin := newMockServer("through socks", http.StatusOK)
+	defer origin.Close()
+
+	var hits atomic.Int64
+	socks := newSOCKS5Server(t, "user", "pass", &hits)
+	defer socks.Close()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "` + origin.URL + `"
+upstreamProxy = "socks5://user:pass@` + socks.Addr().String() + `"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	handler := newTestProxyHandler(testDB, conf)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/test", nil))
+
+	if rr.Code != http.StatusOK || rr.Body.String() != "through socks" {
+		t.Fatalf("expected 200 'through socks', got %d '%s'", rr.Code, rr.Body.String())
+	}
+	if hits.Load() != 1 {
+		t.Errorf("expected 1 connection through the SOCKS5 proxy, got %d", hits.Load())
+	}
+}
+
+func TestProxyUpstreamProxy_FailuresAtProxyLoggedDistinctly(t *testing.T) {
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	socks := newSOCKS5Server(t, "user", "pass", &atomic.Int64{})
+	defer socks.Close()
+
+	origin := newMockServer("ok", http.StatusOK)
+	defer origin.Close()
+
+	tests := []struct {
+		name           string
+		target         string
+		upstreamProxy  string
+		expectedFailed bool
+	}{
+		{"proxy unreachable", origin.URL, "http://" + closedAddr, true},
+		{"proxy rejects credentials", origin.URL, "socks5://user:wrong@" + socks.Addr().String(), true},
+		{"target unreachable without proxy", "http://" + closedAddr, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB, cleanupDB := setupTestDB()
+			defer cleanupDB()
+
+			configContent := `[[proxy]]
+prefix = "/api"
+target = "` + tt.target + `"
+upstreamProxy = "` + tt.upstreamProxy + `"`
+
+			conf, cleanupConfig := createTestConfig(configContent)
+			defer cleanupConfig()
+
+			rlSvc := requestlog.NewRequestLogService(testDB)
+			handler := proxy.NewProxyHandler(rlSvc, conf)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/test", nil))
+
+			if rr.Code != http.StatusBadGateway {
+				t.Errorf("expected status %d, got %d", http.StatusBadGateway, rr.Code)
+			}
+
+			time.Sleep(100 * time.Millisecond)
+
+			logs, err := rlSvc.GetList()
+			if err != nil || len(logs) != 1 {
+				t.Fatalf("expected 1 log, got %d (%v)", len(logs), err)
+			}
+			if logs[0].UpstreamProxyFailed != tt.expectedFailed {
+				t.Errorf("expected upstreamProxyFailed %v, got %v (error '%s')", tt.expectedFailed, logs[0].UpstreamProxyFailed, logs[0].Error)
+			}
+			if tt.expectedFailed && !strings.Contains(rr.Body.String(), "upstream proxy") {
+				t.Errorf("expected the error to name the upstream proxy, got '%s'", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestProxyUpstreamProxy_InvalidConfig(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+
+	configContent := `[[proxy]]
+prefix = "/api"
+target = "http://localhost:1"
+upstreamProxy = "ftp://proxy:21"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	proxyHandler := newTestProxyHandler(testDB, conf)
+
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/test", nil))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d for an unsupported proxy scheme, got %d", http.StatusInternalServerError, rr.Code)
+	}
+}
+
+// newSOCKS5Server starts a SOCKS5 server that requires a username and password, see RFC 1928 and RFC 1929.
+// hits counts the connections it opened to targets.
+func newSOCKS5Server(t *testing.T, username, password string, hits *atomic.Int64) net.Listener {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS5(conn, username, password, hits)
+		}
+	}()
+
+	return l
+}
+
+func serveSOCKS5(conn net.Conn, username, password string, hits *atomic.Int64) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+
+	readBytes := func(n int) []byte {
+		buf := make([]byte, n)
+		io.ReadFull(br, buf)
+		return buf
+	}
+	readString := func() string {
+		n, _ := br.ReadByte()
+		return string(readBytes(int(n)))
+	}
+
+	// Greeting: version, methods. Only username and password authentication is accepted.
+	greeting := readBytes(2)
+	if !bytes.Contains(readBytes(int(greeting[1])), []byte{2}) {
+		conn.Write([]byte{5, 0xff})
+		return
+	}
+	conn.Write([]byte{5, 2})
+
+	// Authentication: version, username, password.
+	br.ReadByte()
+	if readString() != username || readString() != password {
+		conn.Write([]byte{1, 1})
+		return
+	}
+	conn.Write([]byte{1, 0})
+
+	// Request: version, command, reserved, address type, address, port.
+	request := readBytes(4)
+	var host string
+	switch request[3] {
+	case 1:
+		host = net.IP(readBytes(4)).String()
+	case 3:
+		host = readString()
+	case 4:
+		host = net.IP(readBytes(16)).String()
+	}
+	port := binary.BigEndian.Uint16(readBytes(2))
+
+	target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	hits.Add(1)
+
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	go io.Copy(target, br)
+	io.Copy(conn, target)
+}
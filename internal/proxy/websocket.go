@@ -0,0 +1,210 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mishankov/proxymini/internal/requestlog"
+	"github.com/mishankov/proxymini/internal/utils"
+)
+
+const (
+	// maxWebSocketFramePayload is the number of payload bytes of a frame kept in the log.
+	maxWebSocketFramePayload = 64 << 10
+	// maxWebSocketFrames is the number of frames of a connection kept in the log.
+	maxWebSocketFrames = 10_000
+)
+
+// isWebSocketUpgrade reports whether the request asks to switch the connection to the WebSocket protocol.
+func isWebSocketUpgrade(r *http.Request) bool {
+	return headerHasToken(r.Header, "Connection", "upgrade") && strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// headerHasToken reports whether a comma-separated header contains the token, ignoring case.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// webSocketTargetToHTTP maps ws:// and wss:// targets to the URLs the handshake is sent to.
+func webSocketTargetToHTTP(target string) string {
+	if rest, ok := strings.CutPrefix(target, "ws://"); ok {
+		return "http://" + rest
+	}
+	if rest, ok := strings.CutPrefix(target, "wss://"); ok {
+		return "https://" + rest
+	}
+
+	return target
+}
+
+// relayWebSocket completes the upgrade with the client and relays frames both ways until one side closes the connection.
+// The connection is logged when it is established and logged again with its duration when it ends.
+func (ph *ProxyHandler) relayWebSocket(w http.ResponseWriter, r *http.Request, route *route, resp *http.Response, reqLog requestlog.RequestLog, startedAt time.Time) {
+	upstreamConn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		handleError(w, fmt.Errorf("upstream switched protocols without a writable connection"), http.StatusBadGateway)
+		return
+	}
+	defer upstreamConn.Close()
+
+	clientConn, clientBuf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		handleError(w, fmt.Errorf("error hijacking connection: %w", err), http.StatusInternalServerError)
+		return
+	}
+	defer clientConn.Close()
+
+	handshake := *resp
+	handshake.Header = w.Header()
+	handshake.Body = nil
+	if err := handshake.Write(clientBuf); err != nil {
+		return
+	}
+	if err := clientBuf.Flush(); err != nil {
+		return
+	}
+
+	ph.saveLog(r, route, reqLog)
+
+	var recorder *frameRecorder
+	if !route.SkipLogging {
+		recorder = &frameRecorder{rlSvc: ph.rlSvc, requestLogID: reqLog.ID}
+	}
+
+	errc := make(chan error, 2)
+	go func() { errc <- relayFrames(upstreamConn, clientBuf.Reader, requestlog.DirectionToUpstream, recorder) }()
+	go func() { errc <- relayFrames(clientConn, upstreamConn, requestlog.DirectionToClient, recorder) }()
+
+	err = <-errc
+	clientConn.Close()
+	upstreamConn.Close()
+	<-errc
+
+	reqLog.ElapsedMS = time.Since(startedAt).Milliseconds()
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+		reqLog.Error = err.Error()
+	}
+	ph.saveLog(r, route, reqLog)
+}
+
+// frameRecorder stores the relayed frames of a connection up to maxWebSocketFrames.
+// A nil recorder stores nothing.
+type frameRecorder struct {
+	rlSvc        *requestlog.RequestLogService
+	requestLogID string
+	count        atomic.Int64
+}
+
+func (fr *frameRecorder) record(direction string, opcode int, size int64, payload []byte) {
+	if fr == nil || fr.count.Add(1) > maxWebSocketFrames {
+		return
+	}
+
+	fr.rlSvc.SaveFrame(requestlog.NewWebSocketFrame(fr.requestLogID, direction, opcode, size, payload))
+}
+
+// relayFrames copies WebSocket frames from src to dst unchanged and records each of them.
+func relayFrames(dst io.Writer, src io.Reader, direction string, recorder *frameRecorder) error {
+	br := bufio.NewReader(src)
+	for {
+		header, err := readFrameHeader(br)
+		if err != nil {
+			return err
+		}
+
+		if _, err := dst.Write(header.raw); err != nil {
+			return err
+		}
+
+		payload := &utils.LimitedBuffer{Limit: maxWebSocketFramePayload}
+		if _, err := io.CopyN(dst, io.TeeReader(br, payload), header.length); err != nil {
+			return err
+		}
+
+		recorder.record(direction, header.opcode, header.length, header.unmask(payload.Bytes()))
+	}
+}
+
+// frameHeader is a parsed WebSocket frame header, see RFC 6455, section 5.2.
+type frameHeader struct {
+	raw     []byte
+	opcode  int
+	length  int64
+	masked  bool
+	maskKey [4]byte
+}
+
+func readFrameHeader(br *bufio.Reader) (frameHeader, error) {
+	var header frameHeader
+
+	header.raw = make([]byte, 2, 14)
+	if _, err := io.ReadFull(br, header.raw); err != nil {
+		return header, err
+	}
+
+	header.opcode = int(header.raw[0] & 0x0f)
+	header.masked = header.raw[1]&0x80 != 0
+
+	extra := 0
+	switch length := header.raw[1] & 0x7f; length {
+	case 126:
+		extra = 2
+	case 127:
+		extra = 8
+	default:
+		header.length = int64(length)
+	}
+	if header.masked {
+		extra += 4
+	}
+
+	header.raw = header.raw[:2+extra]
+	if _, err := io.ReadFull(br, header.raw[2:]); err != nil {
+		return header, fmt.Errorf("reading websocket frame header: %w", err)
+	}
+
+	rest := header.raw[2:]
+	switch header.raw[1] & 0x7f {
+	case 126:
+		header.length = int64(binary.BigEndian.Uint16(rest))
+		rest = rest[2:]
+	case 127:
+		header.length = int64(binary.BigEndian.Uint64(rest) & (1<<63 - 1))
+		rest = rest[8:]
+	}
+	if header.masked {
+		copy(header.maskKey[:], rest)
+	}
+
+	return header, nil
+}
+
+// unmask returns the payload prefix with the client mask removed.
+func (h frameHeader) unmask(payload []byte) []byte {
+	if !h.masked {
+		return payload
+	}
+
+	res := make([]byte, len(payload))
+	for i, b := range payload {
+		res[i] = b ^ h.maskKey[i%4]
+	}
+
+	return res
+}
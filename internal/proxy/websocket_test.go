@@ -0,0 +1,154 @@
+package proxy_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mishankov/proxymini/internal/proxy"
+	"github.com/mishankov/proxymini/internal/requestlog"
+)
+
+func TestProxyWebSocket_RelaysAndLogsFrames(t *testing.T) {
+	testDB, cleanupDB := setupTestDB()
+	defer cleanupDB()
+	// Frames and logs are saved from different goroutines, keep them on the same in-memory database.
+	testDB.SetMaxOpenConns(1)
+
+	upstream := newWebSocketEchoServer()
+	defer upstream.Close()
+
+	configContent := `[[proxy]]
+prefix = "/ws"
+target = "ws` + upstream.URL[len("http"):] + `"`
+
+	conf, cleanupConfig := createTestConfig(configContent)
+	defer cleanupConfig()
+
+	rlSvc := requestlog.NewRequestLogService(testDB)
+	proxyServer := httptest.NewServer(proxy.NewProxyHandler(rlSvc, conf))
+	defer proxyServer.Close()
+
+	conn, err := net.Dial("tcp", proxyServer.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to connect to proxy: %v", err)
+	}
+	defer conn.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, proxyServer.URL+"/ws/echo", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("failed to write handshake: %v", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatalf("failed to read handshake response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected status %d, got %d", http.StatusSwitchingProtocols, resp.StatusCode)
+	}
+
+	// A masked text frame with the payload "hello".
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x81, 0x80 | 5}
+	frame = append(frame, mask...)
+	for i, b := range []byte("hello") {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	echo := make([]byte, 7)
+	if _, err := io.ReadFull(br, echo); err != nil {
+		t.Fatalf("failed to read echoed frame: %v", err)
+	}
+	if string(echo[2:]) != "hello" {
+		t.Errorf("expected echoed payload 'hello', got '%s'", string(echo[2:]))
+	}
+
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	logs, err := rlSvc.GetList()
+	if err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 connection log, got %d", len(logs))
+	}
+	if logs[0].Status != http.StatusSwitchingProtocols {
+		t.Errorf("expected logged status %d, got %d", http.StatusSwitchingProtocols, logs[0].Status)
+	}
+
+	frames, err := rlSvc.GetFrames(logs[0].ID)
+	if err != nil {
+		t.Fatalf("failed to get frames: %v", err)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("expected 2 frames, got %d", len(frames))
+	}
+
+	expectedDirections := []string{requestlog.DirectionToUpstream, requestlog.DirectionToClient}
+	for i, frame := range frames {
+		if frame.Direction != expectedDirections[i] {
+			t.Errorf("frame %d: expected direction '%s', got '%s'", i, expectedDirections[i], frame.Direction)
+		}
+		if frame.Opcode != 1 {
+			t.Errorf("frame %d: expected text opcode, got %d", i, frame.Opcode)
+		}
+		if frame.Payload != "hello" {
+			t.Errorf("frame %d: expected payload 'hello', got '%s'", i, frame.Payload)
+		}
+	}
+}
+
+// newWebSocketEchoServer returns a server that accepts any WebSocket handshake
+// and sends every frame it receives back unmasked.
+func newWebSocketEchoServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		brw.Flush()
+
+		for {
+			header := make([]byte, 2)
+			if _, err := io.ReadFull(brw, header); err != nil {
+				return
+			}
+
+			length := int(header[1] & 0x7f)
+			mask := make([]byte, 4)
+			if header[1]&0x80 != 0 {
+				if _, err := io.ReadFull(brw, mask); err != nil {
+					return
+				}
+			}
+
+			payload := make([]byte, length)
+			if _, err := io.ReadFull(brw, payload); err != nil {
+				return
+			}
+			for i := range payload {
+				payload[i] ^= mask[i%4]
+			}
+
+			conn.Write(append([]byte{header[0], byte(length)}, payload...))
+		}
+	}))
+}
@@ -0,0 +1,63 @@
+package requestlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// StreamEvent is an event of a streaming response, such as Server-Sent Events, recorded while the stream is live.
+// The response itself is stored as a RequestLog.
+type StreamEvent struct {
+	ID           int64  `json:"id"`
+	RequestLogID string `db:"request_log_id" json:"requestLogId"`
+	TimeMS       int64  `db:"time_ms" json:"timeMs"`
+	Size         int64  `json:"size"`
+	Data         string `json:"data"`
+	Truncated    bool   `json:"truncated"`
+}
+
+// NewStreamEvent creates an event record. data may be a prefix of an event of the given size.
+func NewStreamEvent(requestLogID string, size int64, data []byte) StreamEvent {
+	return StreamEvent{
+		RequestLogID: requestLogID,
+		TimeMS:       time.Now().UTC().UnixMilli(),
+		Size:         size,
+		Data:         string(data),
+		Truncated:    int64(len(data)) < size,
+	}
+}
+
+// jsonStreamEvent is a StreamEvent with binary data moved to a base64 field,
+// because JSON strings can only hold valid UTF-8.
+type jsonStreamEvent struct {
+	streamEvent
+	Data       string `json:"data"`
+	DataBase64 string `json:"dataBase64,omitempty"`
+}
+
+// streamEvent has the fields of StreamEvent without its methods.
+type streamEvent StreamEvent
+
+// MarshalJSON encodes text data as strings and binary data as base64 in dataBase64.
+func (e StreamEvent) MarshalJSON() ([]byte, error) {
+	res := jsonStreamEvent{streamEvent: streamEvent(e)}
+	res.Data, res.DataBase64 = encodeBody(e.Data)
+
+	return json.Marshal(res)
+}
+
+func (e *StreamEvent) UnmarshalJSON(data []byte) error {
+	var res jsonStreamEvent
+	if err := json.Unmarshal(data, &res); err != nil {
+		return err
+	}
+
+	var err error
+	*e = StreamEvent(res.streamEvent)
+	if e.Data, err = decodeBody(res.Data, res.DataBase64); err != nil {
+		return fmt.Errorf("decoding data: %w", err)
+	}
+
+	return nil
+}
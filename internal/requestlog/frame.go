@@ -0,0 +1,72 @@
+package requestlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Directions of WebSocket frames.
+const (
+	DirectionToUpstream = "to-upstream"
+	DirectionToClient   = "to-client"
+)
+
+// WebSocketFrame is a frame of a proxied WebSocket connection. The connection itself is stored as a RequestLog.
+type WebSocketFrame struct {
+	ID           int64  `json:"id"`
+	RequestLogID string `db:"request_log_id" json:"requestLogId"`
+	TimeMS       int64  `db:"time_ms" json:"timeMs"`
+	Direction    string `json:"direction"`
+	Opcode       int    `json:"opcode"`
+	Size         int64  `json:"size"`
+	Payload      string `json:"payload"`
+	Truncated    bool   `json:"truncated"`
+}
+
+// NewWebSocketFrame creates a frame record. payload may be a prefix of a frame of the given size.
+func NewWebSocketFrame(requestLogID, direction string, opcode int, size int64, payload []byte) WebSocketFrame {
+	return WebSocketFrame{
+		RequestLogID: requestLogID,
+		TimeMS:       time.Now().UTC().UnixMilli(),
+		Direction:    direction,
+		Opcode:       opcode,
+		Size:         size,
+		Payload:      string(payload),
+		Truncated:    int64(len(payload)) < size,
+	}
+}
+
+// jsonWebSocketFrame is a WebSocketFrame with a binary payload moved to a base64 field,
+// because JSON strings can only hold valid UTF-8.
+type jsonWebSocketFrame struct {
+	webSocketFrame
+	Payload       string `json:"payload"`
+	PayloadBase64 string `json:"payloadBase64,omitempty"`
+}
+
+// webSocketFrame has the fields of WebSocketFrame without its methods.
+type webSocketFrame WebSocketFrame
+
+// MarshalJSON encodes text payloads as strings and binary payloads as base64 in payloadBase64.
+func (f WebSocketFrame) MarshalJSON() ([]byte, error) {
+	res := jsonWebSocketFrame{webSocketFrame: webSocketFrame(f)}
+	res.Payload, res.PayloadBase64 = encodeBody(f.Payload)
+
+	return json.Marshal(res)
+}
+
+func (f *WebSocketFrame) UnmarshalJSON(data []byte) error {
+	var res jsonWebSocketFrame
+	if err := json.Unmarshal(data, &res); err != nil {
+		return err
+	}
+
+	var err error
+	*f = WebSocketFrame(res.webSocketFrame)
+	if f.Payload, err = decodeBody(res.Payload, res.PayloadBase64); err != nil {
+		return fmt.Errorf("decoding payload: %w", err)
+	}
+
+	return nil
+}
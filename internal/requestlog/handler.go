@@ -2,7 +2,9 @@ package requestlog
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -47,6 +49,157 @@ func (rlh *RequestLogHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// WebSocketFrameHandler serves the frames of a WebSocket connection. It expects the request log ID as the {id} path value.
+type WebSocketFrameHandler struct {
+	rlSvc *RequestLogService
+}
+
+func NewWebSocketFrameHandler(rlSvc *RequestLogService) *WebSocketFrameHandler {
+	return &WebSocketFrameHandler{rlSvc: rlSvc}
+}
+
+func (wfh *WebSocketFrameHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !findLog(w, r, wfh.rlSvc) {
+		return
+	}
+
+	res, err := wfh.rlSvc.GetFrames(r.PathValue("id"))
+	if err != nil {
+		writeError(w, fmt.Errorf("getting websocket frames: %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		writeError(w, fmt.Errorf("getting websocket frames: %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// StreamEventHandler serves the events of a streaming response. It expects the request log ID as the {id} path value.
+type StreamEventHandler struct {
+	rlSvc *RequestLogService
+}
+
+func NewStreamEventHandler(rlSvc *RequestLogService) *StreamEventHandler {
+	return &StreamEventHandler{rlSvc: rlSvc}
+}
+
+func (seh *StreamEventHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !findLog(w, r, seh.rlSvc) {
+		return
+	}
+
+	res, err := seh.rlSvc.GetEvents(r.PathValue("id"))
+	if err != nil {
+		writeError(w, fmt.Errorf("getting stream events: %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		writeError(w, fmt.Errorf("getting stream events: %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// BodyHandler serves the captured body of a log with its original Content-Type and Content-Encoding.
+// Response bodies that were decoded for the log are served decoded.
+// It expects the request log ID as the {id} path value and "request" or "response" as the {part} path value.
+// The body is served as an attachment when the download query parameter is set.
+type BodyHandler struct {
+	rlSvc *RequestLogService
+}
+
+func NewBodyHandler(rlSvc *RequestLogService) *BodyHandler {
+	return &BodyHandler{rlSvc: rlSvc}
+}
+
+func (bh *BodyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rl, err := bh.rlSvc.Get(r.PathValue("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("getting request log: %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	var body, contentType, encoding string
+	switch part := r.PathValue("part"); part {
+	case "request":
+		body, contentType, encoding = rl.RequestBody, rl.RequestContentType, rl.RequestEncoding
+	case "response":
+		body, contentType, encoding = rl.ResponseBody, rl.ResponseContentType, rl.ResponseEncoding
+		if rl.ResponseBodyDecoded {
+			encoding = ""
+		}
+	default:
+		http.Error(w, fmt.Sprintf("unknown body %q, expected request or response", part), http.StatusNotFound)
+		return
+	}
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	// Bodies come from upstreams and clients, so they must not be sniffed or run scripts on the origin of the web UI.
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	if r.URL.Query().Has("download") {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s"`, rl.ID, r.PathValue("part")))
+	}
+
+	w.Write([]byte(body))
+}
+
+// findLog reports whether the request log with the {id} path value exists.
+// Otherwise it responds with 404 Not Found, or 500 Internal Server Error if the lookup failed.
+func findLog(w http.ResponseWriter, r *http.Request, rlSvc *RequestLogService) bool {
+	_, err := rlSvc.Get(r.PathValue("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return false
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("getting request log: %w", err), http.StatusInternalServerError)
+		return false
+	}
+
+	return true
+}
+
+// writeError logs the error and responds with it and the status.
+func writeError(w http.ResponseWriter, err error, status int) {
+	log.ErrorContext(context.Background(), "request handling error", "status", status, "error", err)
+	http.Error(w, err.Error(), status)
+}
+
 func handleError(w http.ResponseWriter, err error, status int) {
 	log.ErrorContext(context.Background(), "request handling error", "status", status, "error", err)
 	// w.WriteHeader(status)
@@ -290,6 +290,240 @@ func TestDeleteOlderThan_RemovesOnlyOldLogs(t *testing.T) {
 	}
 }
 
+func TestGetFrames_ReturnsFramesOfConnection(t *testing.T) {
+	testDB, cleanup := setupTestDB()
+	defer cleanup()
+	testDB.SetMaxOpenConns(1)
+
+	rlSvc := requestlog.NewRequestLogService(testDB)
+
+	conn := createTestRequestLog(http.MethodGet, "http://proxy.example.com/ws")
+	conn.ID = "conn-1"
+	rlSvc.Save(conn)
+
+	rlSvc.SaveFrame(requestlog.NewWebSocketFrame("conn-1", requestlog.DirectionToUpstream, 1, 4, []byte("ping")))
+	rlSvc.SaveFrame(requestlog.NewWebSocketFrame("conn-2", requestlog.DirectionToUpstream, 1, 5, []byte("other")))
+	rlSvc.SaveFrame(requestlog.NewWebSocketFrame("conn-1", requestlog.DirectionToClient, 1, 10, []byte("pong")))
+
+	time.Sleep(50 * time.Millisecond)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/logs/{id}/frames", requestlog.NewWebSocketFrameHandler(rlSvc))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/logs/conn-1/frames", nil)
+	rr := httptest.NewRecorder()
+
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var frames []requestlog.WebSocketFrame
+	if err := json.Unmarshal(rr.Body.Bytes(), &frames); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	if len(frames) != 2 {
+		t.Fatalf("expected 2 frames, got %d", len(frames))
+	}
+
+	if frames[0].Payload != "ping" || frames[1].Payload != "pong" {
+		t.Errorf("expected frames in relay order, got '%s' and '%s'", frames[0].Payload, frames[1].Payload)
+	}
+
+	if frames[0].Truncated {
+		t.Errorf("expected complete frame not to be truncated")
+	}
+	if !frames[1].Truncated {
+		t.Errorf("expected frame with a partial payload to be truncated")
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/logs/missing/frames", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for a missing log, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestGetFrames_BinaryPayloadRoundTrips(t *testing.T) {
+	testDB, cleanup := setupTestDB()
+	defer cleanup()
+	testDB.SetMaxOpenConns(1)
+
+	rlSvc := requestlog.NewRequestLogService(testDB)
+
+	conn := createTestRequestLog(http.MethodGet, "http://proxy.example.com/ws")
+	rlSvc.Save(conn)
+
+	payload := []byte{0x00, 0xff, 0xfe, 0x80, 'o', 'k'}
+	rlSvc.SaveFrame(requestlog.NewWebSocketFrame(conn.ID, requestlog.DirectionToClient, 2, int64(len(payload)), payload))
+
+	time.Sleep(50 * time.Millisecond)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/logs/{id}/frames", requestlog.NewWebSocketFrameHandler(rlSvc))
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/logs/"+conn.ID+"/frames", nil))
+
+	var frames []requestlog.WebSocketFrame
+	if err := json.Unmarshal(rr.Body.Bytes(), &frames); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(frames) != 1 {
+		t.Fatalf("expected 1 frame, got %d", len(frames))
+	}
+	if frames[0].Payload != string(payload) {
+		t.Errorf("expected binary payload to round-trip byte for byte, got %q", frames[0].Payload)
+	}
+
+	var typ string
+	if err := testDB.Get(&typ, "SELECT typeof(payload) FROM websocket_frame"); err != nil {
+		t.Fatalf("failed to get payload type: %v", err)
+	}
+	if typ != "blob" {
+		t.Errorf("expected payload to be stored as a blob, got %s", typ)
+	}
+}
+
+func TestGetEvents_ReturnsEventsOfStream(t *testing.T) {
+	testDB, cleanup := setupTestDB()
+	defer cleanup()
+	testDB.SetMaxOpenConns(1)
+
+	rlSvc := requestlog.NewRequestLogService(testDB)
+
+	stream := createTestRequestLog(http.MethodGet, "http://proxy.example.com/events")
+	rlSvc.Save(stream)
+	rlSvc.SaveEvent(requestlog.NewStreamEvent(stream.ID, 12, []byte("data: one\n\n")))
+	rlSvc.SaveEvent(requestlog.NewStreamEvent(stream.ID, 12, []byte("data: two\n\n")))
+
+	time.Sleep(50 * time.Millisecond)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/logs/{id}/events", requestlog.NewStreamEventHandler(rlSvc))
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/logs/"+stream.ID+"/events", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var events []requestlog.StreamEvent
+	if err := json.Unmarshal(rr.Body.Bytes(), &events); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/logs/missing/events", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for a missing log, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestGetEvents_BinaryDataRoundTrips(t *testing.T) {
+	testDB, cleanup := setupTestDB()
+	defer cleanup()
+	testDB.SetMaxOpenConns(1)
+
+	rlSvc := requestlog.NewRequestLogService(testDB)
+
+	stream := createTestRequestLog(http.MethodPost, "http://proxy.example.com/grpc.Service/Watch")
+	rlSvc.Save(stream)
+
+	data := []byte{0x00, 0x00, 0x00, 0x00, 0x03, 0xff, 0x80, 0x01}
+	rlSvc.SaveEvent(requestlog.NewStreamEvent(stream.ID, int64(len(data)), data))
+
+	time.Sleep(50 * time.Millisecond)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/logs/{id}/events", requestlog.NewStreamEventHandler(rlSvc))
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/logs/"+stream.ID+"/events", nil))
+
+	var events []requestlog.StreamEvent
+	if err := json.Unmarshal(rr.Body.Bytes(), &events); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	if events[0].Data != string(data) {
+		t.Errorf("expected binary data to round-trip byte for byte, got %q", events[0].Data)
+	}
+
+	var typ string
+	if err := testDB.Get(&typ, "SELECT typeof(data) FROM stream_event"); err != nil {
+		t.Fatalf("failed to get data type: %v", err)
+	}
+	if typ != "blob" {
+		t.Errorf("expected data to be stored as a blob, got %s", typ)
+	}
+}
+
+func TestGetBody_ServesBinaryBodyAsProxied(t *testing.T) {
+	testDB, cleanup := setupTestDB()
+	defer cleanup()
+
+	rlSvc := requestlog.NewRequestLogService(testDB)
+
+	png := "\x89PNG\r\n\x1a\n\x00\xff\xfe"
+	responseHeaders := http.Header{}
+	responseHeaders.Set("Content-Type", "image/png")
+	log := requestlog.New("GET", "http://proxy.example.com/img", "http://upstream.example.com/img", http.Header{}, "", http.StatusOK, responseHeaders, png, 1)
+	rlSvc.Save(log)
+
+	time.Sleep(50 * time.Millisecond)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/logs/{id}/body/{part}", requestlog.NewBodyHandler(rlSvc))
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/logs/"+log.ID+"/body/response?download", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if rr.Body.String() != png {
+		t.Errorf("expected body to be served byte for byte, got %q", rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("expected Content-Type 'image/png', got '%s'", ct)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); cd == "" {
+		t.Errorf("expected body to be served as an attachment")
+	}
+
+	rr = httptest.NewRecorder()
+	newTestRequestLogHandler(testDB).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/logs", nil))
+
+	var logs []requestlog.RequestLog
+	if err := json.Unmarshal(rr.Body.Bytes(), &logs); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 log, got %d", len(logs))
+	}
+	if logs[0].ResponseBody != png {
+		t.Errorf("expected binary body to survive JSON, got %q", logs[0].ResponseBody)
+	}
+	if logs[0].RequestContentType != "" {
+		t.Errorf("expected no content type for an empty body, got '%s'", logs[0].RequestContentType)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/logs/missing/body/response", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for a missing log, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
 func createTestRequestLog(method, url string) requestlog.RequestLog {
 	return requestlog.New(
 		method,
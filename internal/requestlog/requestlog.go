@@ -1,9 +1,12 @@
 package requestlog
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 )
@@ -15,11 +18,54 @@ type RequestLog struct {
 	Method          string `json:"method"`
 	ProxyURL        string `db:"proxy_url" json:"proxyUrl"`
 	URL             string `json:"url"`
+	Upstream        string `json:"upstream"`
+	Attempt         int    `json:"attempt"`
+	Error           string `json:"error"`
+	TimedOut        bool   `db:"timed_out" json:"timedOut"`
 	RequestHeaders  string `db:"request_headers" json:"requestHeaders"`
 	RequestBody     string `db:"request_body" json:"requestBody"`
 	Status          int    `json:"status"`
 	ResponseHeaders string `db:"response_headers" json:"responseHeaders"`
 	ResponseBody    string `db:"response_body" json:"responseBody"`
+
+	// Sizes of the bodies as they were proxied. The stored bodies are cut when they are larger than the capture limit.
+	RequestBodySize       int64 `db:"request_body_size" json:"requestBodySize"`
+	RequestBodyTruncated  bool  `db:"request_body_truncated" json:"requestBodyTruncated"`
+	ResponseBodySize      int64 `db:"response_body_size" json:"responseBodySize"`
+	ResponseBodyTruncated bool  `db:"response_body_truncated" json:"responseBodyTruncated"`
+
+	// ResponseBodyDecoded marks response bodies that are stored decoded from their ResponseEncoding.
+	// ResponseBodySize is the decoded size then, and ResponseBodyEncodedSize is the size that was proxied.
+	ResponseBodyDecoded     bool  `db:"response_body_decoded" json:"responseBodyDecoded"`
+	ResponseBodyEncodedSize int64 `db:"response_body_encoded_size" json:"responseBodyEncodedSize"`
+
+	// Content types and encodings of the bodies, taken from the headers or sniffed from the body when the header is missing.
+	RequestContentType  string `db:"request_content_type" json:"requestContentType"`
+	RequestEncoding     string `db:"request_encoding" json:"requestEncoding"`
+	ResponseContentType string `db:"response_content_type" json:"responseContentType"`
+	ResponseEncoding    string `db:"response_encoding" json:"responseEncoding"`
+
+	// Tunnel marks CONNECT tunnels of the forward proxy. Their body sizes are the bytes relayed in each direction.
+	Tunnel bool `json:"tunnel"`
+
+	// Streaming marks responses whose events are recorded separately while the stream is live, see StreamEvent.
+	Streaming bool `json:"streaming"`
+
+	// Protocols the request was received with and proxied to the upstream with, such as "HTTP/1.1" or "HTTP/2.0".
+	Protocol         string `json:"protocol"`
+	UpstreamProtocol string `db:"upstream_protocol" json:"upstreamProtocol"`
+
+	// UpstreamProxy is the proxy the request was sent through, without credentials.
+	// UpstreamProxyFailed marks errors at that proxy, as opposed to errors at the target.
+	UpstreamProxy       string `db:"upstream_proxy" json:"upstreamProxy"`
+	UpstreamProxyFailed bool   `db:"upstream_proxy_failed" json:"upstreamProxyFailed"`
+
+	// gRPC calls record the status from the trailers and, if the route has descriptor sets,
+	// their messages decoded into JSON arrays.
+	GRPCStatus       string `db:"grpc_status" json:"grpcStatus"`
+	GRPCMessage      string `db:"grpc_message" json:"grpcMessage"`
+	RequestMessages  string `db:"request_messages" json:"requestMessages"`
+	ResponseMessages string `db:"response_messages" json:"responseMessages"`
 }
 
 func New(
@@ -36,6 +82,7 @@ func New(
 
 	return RequestLog{
 		ID:              uuid.NewString(),
+		Attempt:         1,
 		Time:            time.Now().UTC().Unix(),
 		ElapsedMS:       elapsedMS,
 		Method:          method,
@@ -46,5 +93,100 @@ func New(
 		Status:          status,
 		ResponseHeaders: string(responseHeadersBytes),
 		ResponseBody:    responseBody,
+
+		RequestBodySize:  int64(len(requestBody)),
+		ResponseBodySize: int64(len(responseBody)),
+
+		RequestContentType:  detectContentType(requestHeaders, requestBody),
+		RequestEncoding:     requestHeaders.Get("Content-Encoding"),
+		ResponseContentType: detectContentType(responseHeaders, responseBody),
+		ResponseEncoding:    responseHeaders.Get("Content-Encoding"),
+	}
+}
+
+// jsonRequestLog is a RequestLog with binary bodies moved to base64 fields,
+// because JSON strings can only hold valid UTF-8.
+type jsonRequestLog struct {
+	requestLog
+	RequestBody        string `json:"requestBody"`
+	RequestBodyBase64  string `json:"requestBodyBase64,omitempty"`
+	ResponseBody       string `json:"responseBody"`
+	ResponseBodyBase64 string `json:"responseBodyBase64,omitempty"`
+}
+
+// requestLog has the fields of RequestLog without its methods.
+type requestLog RequestLog
+
+// MarshalJSON encodes text bodies as strings and binary bodies as base64
+// in requestBodyBase64 and responseBodyBase64.
+func (rl RequestLog) MarshalJSON() ([]byte, error) {
+	res := jsonRequestLog{requestLog: requestLog(rl)}
+	res.RequestBody, res.RequestBodyBase64 = encodeBody(rl.RequestBody)
+	res.ResponseBody, res.ResponseBodyBase64 = encodeBody(rl.ResponseBody)
+
+	return json.Marshal(res)
+}
+
+func (rl *RequestLog) UnmarshalJSON(data []byte) error {
+	var res jsonRequestLog
+	if err := json.Unmarshal(data, &res); err != nil {
+		return err
+	}
+
+	var err error
+	*rl = RequestLog(res.requestLog)
+	if rl.RequestBody, err = decodeBody(res.RequestBody, res.RequestBodyBase64); err != nil {
+		return fmt.Errorf("decoding request body: %w", err)
+	}
+	if rl.ResponseBody, err = decodeBody(res.ResponseBody, res.ResponseBodyBase64); err != nil {
+		return fmt.Errorf("decoding response body: %w", err)
 	}
+
+	return nil
+}
+
+func encodeBody(body string) (text, b64 string) {
+	if isText(body) {
+		return body, ""
+	}
+
+	return "", base64.StdEncoding.EncodeToString([]byte(body))
+}
+
+func decodeBody(text, b64 string) (string, error) {
+	if b64 == "" {
+		return text, nil
+	}
+
+	body, err := base64.StdEncoding.DecodeString(b64)
+	return string(body), err
+}
+
+// isText reports whether the body is valid UTF-8. A body cut by the capture limit
+// may end in the middle of a character, which still counts as text.
+func isText(body string) bool {
+	if utf8.ValidString(body) {
+		return true
+	}
+
+	for i := 1; i < utf8.UTFMax && i <= len(body); i++ {
+		if start := len(body) - i; utf8.RuneStart(body[start]) {
+			return !utf8.FullRuneInString(body[start:]) && utf8.ValidString(body[:start])
+		}
+	}
+
+	return false
+}
+
+// detectContentType returns the Content-Type header, or the type sniffed from the body if the header is missing.
+func detectContentType(headers http.Header, body string) string {
+	if contentType := headers.Get("Content-Type"); contentType != "" {
+		return contentType
+	}
+
+	if body == "" {
+		return ""
+	}
+
+	return http.DetectContentType([]byte(body))
 }
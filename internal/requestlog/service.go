@@ -5,14 +5,21 @@ import (
 	"github.com/platforma-dev/platforma/log"
 )
 
+// frameBufferSize is the number of WebSocket frames or stream events that can wait to be saved before relaying slows down.
+const frameBufferSize = 256
+
 type RequestLogService struct {
 	db           *sqlx.DB
 	requestLogCh chan RequestLog
+	frameCh      chan WebSocketFrame
+	eventCh      chan StreamEvent
 }
 
 func NewRequestLogService(db *sqlx.DB) *RequestLogService {
 	ch := make(chan RequestLog)
-	rls := &RequestLogService{db: db, requestLogCh: ch}
+	frameCh := make(chan WebSocketFrame, frameBufferSize)
+	eventCh := make(chan StreamEvent, frameBufferSize)
+	rls := &RequestLogService{db: db, requestLogCh: ch, frameCh: frameCh, eventCh: eventCh}
 	go func() {
 		for l := range ch {
 			err := rls.save(l)
@@ -21,6 +28,22 @@ func NewRequestLogService(db *sqlx.DB) *RequestLogService {
 			}
 		}
 	}()
+	go func() {
+		for f := range frameCh {
+			err := rls.saveFrame(f)
+			if err != nil {
+				log.Error("failed to save websocket frame from channel", "error", err)
+			}
+		}
+	}()
+	go func() {
+		for e := range eventCh {
+			err := rls.saveEvent(e)
+			if err != nil {
+				log.Error("failed to save stream event from channel", "error", err)
+			}
+		}
+	}()
 	return rls
 }
 
@@ -46,10 +69,25 @@ func (rls *RequestLogService) GetList() ([]RequestLog, error) {
 	return res, nil
 }
 
+// Get returns the request log with the given ID. It returns sql.ErrNoRows if there is no such log.
+func (rls *RequestLogService) Get(id string) (RequestLog, error) {
+	var res RequestLog
+	err := rls.db.Get(&res, "SELECT * FROM request_log WHERE id = ?", id)
+
+	return res, err
+}
+
+// save inserts the request log or replaces the one with the same ID,
+// so a log saved at the start of a long-lived connection can be updated when it ends.
 func (rls *RequestLogService) save(rl RequestLog) error {
 	_, err := rls.db.Exec(
-		"INSERT INTO request_log (id, time, elapsed_ms, method, proxy_url, url, request_headers, request_body, status, response_headers, response_body) VALUES (?,?,?,?,?,?,?,?,?,?,?)",
-		rl.ID, rl.Time, rl.ElapsedMS, rl.Method, rl.ProxyURL, rl.URL, rl.RequestHeaders, rl.RequestBody, rl.Status, rl.ResponseHeaders, rl.ResponseBody,
+		"INSERT OR REPLACE INTO request_log (id, time, elapsed_ms, method, proxy_url, url, upstream, attempt, error, timed_out, request_headers, request_body, status, response_headers, response_body, request_body_size, request_body_truncated, response_body_size, response_body_truncated, response_body_decoded, response_body_encoded_size, request_content_type, request_encoding, response_content_type, response_encoding, streaming, protocol, upstream_protocol, grpc_status, grpc_message, request_messages, response_messages, tunnel, upstream_proxy, upstream_proxy_failed) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)",
+		// Bodies are bound as []byte, so they are stored as BLOBs exactly as they were proxied.
+		rl.ID, rl.Time, rl.ElapsedMS, rl.Method, rl.ProxyURL, rl.URL, rl.Upstream, rl.Attempt, rl.Error, rl.TimedOut, rl.RequestHeaders, []byte(rl.RequestBody), rl.Status, rl.ResponseHeaders, []byte(rl.ResponseBody),
+		rl.RequestBodySize, rl.RequestBodyTruncated, rl.ResponseBodySize, rl.ResponseBodyTruncated, rl.ResponseBodyDecoded, rl.ResponseBodyEncodedSize,
+		rl.RequestContentType, rl.RequestEncoding, rl.ResponseContentType, rl.ResponseEncoding, rl.Streaming, rl.Protocol, rl.UpstreamProtocol,
+		rl.GRPCStatus, rl.GRPCMessage, rl.RequestMessages, rl.ResponseMessages, rl.Tunnel,
+		rl.UpstreamProxy, rl.UpstreamProxyFailed,
 	)
 
 	return err
@@ -60,13 +98,79 @@ func (rls *RequestLogService) Save(rl RequestLog) error {
 	return nil
 }
 
+// GetFrames returns the frames of the WebSocket connection with the given request log ID in the order they were relayed.
+func (rls *RequestLogService) GetFrames(requestLogID string) ([]WebSocketFrame, error) {
+	res := []WebSocketFrame{}
+	if err := rls.db.Select(&res, "SELECT * FROM websocket_frame WHERE request_log_id = ? ORDER BY id", requestLogID); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (rls *RequestLogService) saveFrame(f WebSocketFrame) error {
+	_, err := rls.db.Exec(
+		"INSERT INTO websocket_frame (request_log_id, time_ms, direction, opcode, size, payload, truncated) VALUES (?,?,?,?,?,?,?)",
+		// The payload is bound as []byte, so binary frames are stored as BLOBs byte for byte.
+		f.RequestLogID, f.TimeMS, f.Direction, f.Opcode, f.Size, []byte(f.Payload), f.Truncated,
+	)
+
+	return err
+}
+
+func (rls *RequestLogService) SaveFrame(f WebSocketFrame) error {
+	rls.frameCh <- f
+	return nil
+}
+
+// GetEvents returns the events of the streaming response with the given request log ID in the order they arrived.
+func (rls *RequestLogService) GetEvents(requestLogID string) ([]StreamEvent, error) {
+	res := []StreamEvent{}
+	if err := rls.db.Select(&res, "SELECT * FROM stream_event WHERE request_log_id = ? ORDER BY id", requestLogID); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (rls *RequestLogService) saveEvent(e StreamEvent) error {
+	_, err := rls.db.Exec(
+		"INSERT INTO stream_event (request_log_id, time_ms, size, data, truncated) VALUES (?,?,?,?,?)",
+		// The data is bound as []byte, so binary events such as gRPC messages are stored as BLOBs byte for byte.
+		e.RequestLogID, e.TimeMS, e.Size, []byte(e.Data), e.Truncated,
+	)
+
+	return err
+}
+
+func (rls *RequestLogService) SaveEvent(e StreamEvent) error {
+	rls.eventCh <- e
+	return nil
+}
+
 func (rls *RequestLogService) DeleteAll() error {
+	if _, err := rls.db.Exec("DELETE FROM websocket_frame"); err != nil {
+		return err
+	}
+
+	if _, err := rls.db.Exec("DELETE FROM stream_event"); err != nil {
+		return err
+	}
+
 	_, err := rls.db.Exec("DELETE FROM request_log")
 
 	return err
 }
 
 func (rls *RequestLogService) DeleteOlderThan(thresholdUnix int64) error {
+	if _, err := rls.db.Exec("DELETE FROM websocket_frame WHERE time_ms < ?", thresholdUnix*1000); err != nil {
+		return err
+	}
+
+	if _, err := rls.db.Exec("DELETE FROM stream_event WHERE time_ms < ?", thresholdUnix*1000); err != nil {
+		return err
+	}
+
 	_, err := rls.db.Exec("DELETE FROM request_log WHERE time < ?", thresholdUnix)
 	return err
 }
@@ -5,11 +5,11 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"sync"
 )
 
-func CopyBuffer(dst http.ResponseWriter, src io.Reader, buf []byte) ([]byte, error) {
-	var res bytes.Buffer
-
+// CopyBuffer copies src to dst, flushing dst after every read, and writes the copied bytes to capture as well.
+func CopyBuffer(dst http.ResponseWriter, src io.Reader, buf []byte, capture io.Writer) error {
 	if len(buf) == 0 {
 		buf = make([]byte, 32*1024)
 	}
@@ -17,27 +17,73 @@ func CopyBuffer(dst http.ResponseWriter, src io.Reader, buf []byte) ([]byte, err
 	for {
 		nr, rerr := src.Read(buf)
 		if rerr != nil && rerr != io.EOF && rerr != context.Canceled {
-			return res.Bytes(), rerr
+			return rerr
 		}
 		if nr > 0 {
 			nw, werr := dst.Write(buf[:nr])
-			res.Write(buf[:nr])
+			capture.Write(buf[:nr])
 			if nw > 0 {
 				written += int64(nw)
 			}
 			if werr != nil {
-				return res.Bytes(), werr
+				return werr
 			}
 			if nr != nw {
-				return res.Bytes(), io.ErrShortWrite
+				return io.ErrShortWrite
 			}
 		}
 		if rerr != nil {
 			if rerr == io.EOF {
 				rerr = nil
 			}
-			return res.Bytes(), rerr
+			return rerr
 		}
 		http.NewResponseController(dst).Flush()
 	}
 }
+
+// LimitedBuffer is an io.Writer that keeps the first Limit bytes written to it and only counts the rest.
+// It is safe for concurrent use.
+type LimitedBuffer struct {
+	Limit int
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	size  int64
+}
+
+func (b *LimitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.size += int64(len(p))
+
+	if room := b.Limit - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(room, len(p))])
+	}
+
+	return len(p), nil
+}
+
+// Bytes returns the kept bytes.
+func (b *LimitedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return bytes.Clone(b.buf.Bytes())
+}
+
+// Size returns the number of bytes written, including the ones that were not kept.
+func (b *LimitedBuffer) Size() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.size
+}
+
+// Truncated reports whether some of the written bytes were not kept.
+func (b *LimitedBuffer) Truncated() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.size > int64(b.buf.Len())
+}
@@ -5,17 +5,81 @@ export interface RequestLog {
 	method: string;
 	proxyUrl: string;
 	url: string;
+	upstream: string;
+	attempt: number;
+	error: string;
+	timedOut: boolean;
 	requestHeaders: string;
 	requestBody: string;
+	requestBodyBase64?: string;
 	status: number;
 	responseHeaders: string;
 	responseBody: string;
+	responseBodyBase64?: string;
+	requestBodySize: number;
+	requestBodyTruncated: boolean;
+	responseBodySize: number;
+	responseBodyTruncated: boolean;
+	responseBodyDecoded: boolean;
+	responseBodyEncodedSize: number;
+	requestContentType: string;
+	requestEncoding: string;
+	responseContentType: string;
+	responseEncoding: string;
+	tunnel: boolean;
+	streaming: boolean;
+	protocol: string;
+	upstreamProtocol: string;
+	upstreamProxy: string;
+	upstreamProxyFailed: boolean;
+	grpcStatus: string;
+	grpcMessage: string;
+	requestMessages: string;
+	responseMessages: string;
+}
+
+export type FrameDirection = "to-upstream" | "to-client";
+
+export interface WebSocketFrame {
+	id: number;
+	requestLogId: string;
+	timeMs: number;
+	direction: FrameDirection;
+	opcode: number;
+	size: number;
+	payload: string;
+	payloadBase64?: string;
+	truncated: boolean;
+}
+
+export interface StreamEvent {
+	id: number;
+	requestLogId: string;
+	timeMs: number;
+	size: number;
+	data: string;
+	dataBase64?: string;
+	truncated: boolean;
+}
+
+export type UpstreamState = "unknown" | "healthy" | "unhealthy" | "ejected";
+
+export interface UpstreamHealth {
+	route: string;
+	url: string;
+	state: UpstreamState;
+	inFlight: number;
+	consecutiveFailures: number;
+	ejectedUntil?: number;
+	lastCheckedAt?: number;
+	lastStatus?: number;
+	lastError?: string;
 }
 
 export type StatusClass = "2xx" | "3xx" | "4xx" | "5xx" | "unknown";
 export type StatusFilter = Exclude<StatusClass, "unknown">;
 export type SortOption = "timeDesc" | "timeAsc" | "statusDesc";
-export type InspectorTab = "overview" | "request" | "response" | "headers" | "raw";
+export type InspectorTab = "overview" | "request" | "response" | "headers" | "messages" | "events" | "raw";
 
 export interface HeaderEntry {
 	key: string;
@@ -26,10 +90,12 @@ export interface Filters {
 	search: string;
 	methods: Set<string>;
 	statuses: Set<StatusFilter>;
+	hosts: Set<string>;
 }
 
 export interface EnrichedLog extends RequestLog {
 	methodNormalized: string;
+	host: string;
 	statusClass: StatusClass;
 	timeFormatted: string;
 	elapsedFormatted: string;
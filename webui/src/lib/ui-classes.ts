@@ -1,4 +1,4 @@
-import type { StatusClass } from "$lib/types";
+import type { FrameDirection, StatusClass, UpstreamState } from "$lib/types";
 
 export const STATUS_PILL_CLASSES: Record<StatusClass, string> = {
 	"2xx": "bg-emerald-500/15 text-emerald-200",
@@ -16,6 +16,18 @@ export const STATUS_TEXT_CLASSES: Record<StatusClass, string> = {
 	unknown: "text-zinc-300"
 };
 
+export const UPSTREAM_STATE_CLASSES: Record<UpstreamState, string> = {
+	healthy: "bg-emerald-500/15 text-emerald-200",
+	unhealthy: "bg-rose-500/15 text-rose-200",
+	ejected: "bg-amber-500/15 text-amber-200",
+	unknown: "bg-slate-800/70 text-slate-300"
+};
+
+export const FRAME_DIRECTION_CLASSES: Record<FrameDirection, string> = {
+	"to-upstream": "bg-sky-500/15 text-sky-200",
+	"to-client": "bg-emerald-500/15 text-emerald-200"
+};
+
 export const FILTER_CHIP_STATE_CLASSES = {
 	active: "bg-sky-500/20 text-sky-100",
 	inactive: "bg-slate-800/70 text-slate-300 hover:bg-slate-700/80 hover:text-slate-100"
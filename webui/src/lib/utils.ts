@@ -1,4 +1,5 @@
-import type { EnrichedLog, HeaderEntry, RequestLog, StatusClass } from "$lib/types";
+import { STREAM_TAB_OPTIONS, TAB_OPTIONS, WEBSOCKET_TAB_OPTIONS } from "$lib/constants";
+import type { EnrichedLog, HeaderEntry, InspectorTab, RequestLog, StatusClass } from "$lib/types";
 
 export function escapeHtml(value: string): string {
 	return value
@@ -375,6 +376,72 @@ export function formatTimestamp(unixSeconds: number): string {
 	return date.toISOString().replace("T", " ").substring(0, 19);
 }
 
+export function tabOptionsFor(log: RequestLog | null): readonly InspectorTab[] {
+	if (log?.status === 101) {
+		return WEBSOCKET_TAB_OPTIONS;
+	}
+	if (log?.streaming) {
+		return STREAM_TAB_OPTIONS;
+	}
+
+	return TAB_OPTIONS;
+}
+
+export function formatTimestampMs(unixMs: number): string {
+	return new Date(unixMs).toISOString().replace("T", " ").substring(0, 23);
+}
+
+const OPCODE_NAMES: Record<number, string> = {
+	0: "continuation",
+	1: "text",
+	2: "binary",
+	8: "close",
+	9: "ping",
+	10: "pong"
+};
+
+export function opcodeName(opcode: number): string {
+	return OPCODE_NAMES[opcode] ?? `opcode ${opcode}`;
+}
+
+const GRPC_STATUS_NAMES: Record<string, string> = {
+	"0": "OK",
+	"1": "CANCELLED",
+	"2": "UNKNOWN",
+	"3": "INVALID_ARGUMENT",
+	"4": "DEADLINE_EXCEEDED",
+	"5": "NOT_FOUND",
+	"6": "ALREADY_EXISTS",
+	"7": "PERMISSION_DENIED",
+	"8": "RESOURCE_EXHAUSTED",
+	"9": "FAILED_PRECONDITION",
+	"10": "ABORTED",
+	"11": "OUT_OF_RANGE",
+	"12": "UNIMPLEMENTED",
+	"13": "INTERNAL",
+	"14": "UNAVAILABLE",
+	"15": "DATA_LOSS",
+	"16": "UNAUTHENTICATED"
+};
+
+export function grpcStatusName(status: string): string {
+	return GRPC_STATUS_NAMES[status] ?? `status ${status}`;
+}
+
+export function formatBytes(size: number): string {
+	if (size < 1024) {
+		return `${size} bytes`;
+	}
+	if (size < 1024 * 1024) {
+		return `${(size / 1024).toFixed(1)} KiB`;
+	}
+	if (size < 1024 * 1024 * 1024) {
+		return `${(size / (1024 * 1024)).toFixed(1)} MiB`;
+	}
+
+	return `${(size / (1024 * 1024 * 1024)).toFixed(2)} GiB`;
+}
+
 export function formatElapsed(elapsedMs: number): string {
 	if (elapsedMs < 1000) {
 		return `${elapsedMs} ms`;
@@ -404,6 +471,14 @@ export function normalizeMethod(method: string): string {
 	return normalized || "UNKNOWN";
 }
 
+export function hostOf(url: string): string {
+	try {
+		return new URL(url).host.toLowerCase();
+	} catch {
+		return "";
+	}
+}
+
 export function normalizeText(value: string): string {
 	return value.toLowerCase();
 }
@@ -443,6 +518,8 @@ export function buildSearchBlob(log: RequestLog): string {
 			String(log.elapsedMs),
 			log.proxyUrl,
 			log.url,
+			log.upstream,
+			log.error,
 			log.requestHeaders,
 			log.responseHeaders,
 			log.requestBody,
@@ -458,6 +535,7 @@ export function enrichLog(log: RequestLog): EnrichedLog {
 	return {
 		...log,
 		methodNormalized: normalizeMethod(log.method),
+		host: hostOf(log.proxyUrl),
 		statusClass: statusClassOf(Number(log.status)),
 		timeFormatted: formatTimestamp(Number(log.time)),
 		elapsedFormatted: formatElapsed(Number(log.elapsedMs)),